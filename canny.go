@@ -0,0 +1,142 @@
+package sudoku
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+type edgeImage struct {
+	Edges     image.Gray
+	Direction []float64 // Gradient direction (radians) for every pixel, same layout as Edges.Pix
+}
+
+// Sobel operator, returns gradient magnitude and direction for every pixel
+func sobel(src image.Gray) (magnitude, direction []float64) {
+	var wg sync.WaitGroup
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	magnitude = make([]float64, len(src.Pix), len(src.Pix))
+	direction = make([]float64, len(src.Pix), len(src.Pix))
+
+	at := func(x, y int) float64 {
+		return float64(src.Pix[src.PixOffset(inRange(x, width), inRange(y, height))])
+	}
+
+	for y := 0; y < height; y++ {
+		wg.Add(1)
+		go func(y int) {
+			for x := 0; x < width; x++ {
+				gx := (at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1)) -
+					(at(x-1, y-1) + 2*at(x-1, y) + at(x-1, y+1))
+				gy := (at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1)) -
+					(at(x-1, y-1) + 2*at(x, y-1) + at(x+1, y-1))
+
+				pos := src.PixOffset(x, y)
+				magnitude[pos] = math.Hypot(gx, gy)
+				direction[pos] = math.Atan2(gy, gx)
+			}
+			wg.Done()
+		}(y)
+	}
+	wg.Wait()
+	return
+}
+
+// Keeps only pixels that are local maximum along gradient direction
+func nonMaxSuppression(src image.Gray, magnitude, direction []float64) []float64 {
+	var wg sync.WaitGroup
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	suppressed := make([]float64, len(magnitude), len(magnitude))
+
+	for y := 1; y < height-1; y++ {
+		wg.Add(1)
+		go func(y int) {
+			for x := 1; x < width-1; x++ {
+				pos := src.PixOffset(x, y)
+				mag := magnitude[pos]
+				if mag == 0 {
+					continue
+				}
+
+				// Round direction to one of 4 neighbour pairs
+				angle := direction[pos]
+				if angle < 0 {
+					angle += math.Pi
+				}
+				var dx, dy int
+				switch {
+				case angle < math.Pi/8 || angle >= 7*math.Pi/8:
+					dx, dy = 1, 0
+				case angle < 3*math.Pi/8:
+					dx, dy = 1, 1
+				case angle < 5*math.Pi/8:
+					dx, dy = 0, 1
+				default:
+					dx, dy = -1, 1
+				}
+
+				before := magnitude[src.PixOffset(x-dx, y-dy)]
+				after := magnitude[src.PixOffset(x+dx, y+dy)]
+				if mag >= before && mag >= after {
+					suppressed[pos] = mag
+				}
+			}
+			wg.Done()
+		}(y)
+	}
+	wg.Wait()
+	return suppressed
+}
+
+// Marks strong edges and weak edges connected to strong ones
+func hysteresis(src image.Gray, magnitude []float64, low, high float64) image.Gray {
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	dst := *image.NewGray(src.Bounds())
+
+	stack := make([]image.Point, 0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pos := src.PixOffset(x, y)
+			if magnitude[pos] >= high {
+				dst.Pix[pos] = 255
+				stack = append(stack, image.Point{x, y})
+			}
+		}
+	}
+
+	for len(stack) > 0 {
+		pt := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for ky := -1; ky <= 1; ky++ {
+			for kx := -1; kx <= 1; kx++ {
+				x, y := pt.X+kx, pt.Y+ky
+				if x < 0 || x >= width || y < 0 || y >= height {
+					continue
+				}
+				pos := src.PixOffset(x, y)
+				if dst.Pix[pos] == 0 && magnitude[pos] >= low {
+					dst.Pix[pos] = 255
+					stack = append(stack, image.Point{x, y})
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// Canny edge detector
+// - smooths image
+// - computes gradients using Sobel operator
+// - thins edges with non-maximum suppression
+// - connects edges using hysteresis thresholding (low, high)
+func canny(src image.Gray, low, high float64) edgeImage {
+	smooth := mean(src, 1)
+	magnitude, direction := sobel(smooth)
+	suppressed := nonMaxSuppression(smooth, magnitude, direction)
+
+	return edgeImage{
+		Edges:     hysteresis(smooth, suppressed, low, high),
+		Direction: direction,
+	}
+}
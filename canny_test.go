@@ -0,0 +1,55 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSobel(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 5, 5))
+	for y := 0; y < 5; y++ {
+		for x := 3; x < 5; x++ {
+			img.Pix[img.PixOffset(x, y)] = 255
+		}
+	}
+
+	magnitude, direction := sobel(*img)
+
+	assert.InDelta(t, 0, magnitude[img.PixOffset(0, 2)], 0.0001)
+	assert.InDelta(t, 4*255, magnitude[img.PixOffset(2, 2)], 0.0001)
+	assert.InDelta(t, 0, direction[img.PixOffset(2, 2)], 0.0001)
+}
+
+func TestCanny(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			img.Pix[img.PixOffset(x, y)] = 255
+		}
+	}
+
+	edges := canny(*img, 40, 100)
+
+	// Inside and outside of the square is flat
+	assert.EqualValues(t, 0, edges.Edges.GrayAt(20, 20).Y)
+	assert.EqualValues(t, 0, edges.Edges.GrayAt(2, 2).Y)
+
+	// Top and bottom sides produce thin edges
+	count := 0
+	for y := 0; y < 40; y++ {
+		if edges.Edges.GrayAt(20, y).Y != 0 {
+			count++
+		}
+	}
+	assert.True(t, count >= 2 && count <= 4, "Expected thin edges, found %v pixels", count)
+
+	// Left side has horizontal gradient
+	for x := 5; x < 15; x++ {
+		if edges.Edges.GrayAt(x, 20).Y != 0 {
+			angle := edges.Direction[edges.Edges.PixOffset(x, 20)]
+			assert.InDelta(t, 0, normalAngleDistance(angle, 0), 0.0001)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package sudoku
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	cellWarpSize   = 56   // Cells are warped bigger than network input, so cleaning has more details
+	digitImageSize = 28   // Size of learning data set: MNIST
+	digitBoxSize   = 20   // MNIST digits fit 20x20 box centred inside of 28x28 image
+	minDigitArea   = 0.01 // Smaller components (fraction of the cell) are noise
+)
+
+// Pixels darker than threshold become ink, the darker the stronger (0-255).
+// Everything else is background (0).
+func inkImage(cell image.Gray, threshold uint8) image.Gray {
+	bounds := cell.Bounds()
+	ink := *image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			val := cell.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y
+			if val < threshold {
+				ink.Pix[ink.PixOffset(x, y)] = 255 - val
+			}
+		}
+	}
+	return ink
+}
+
+// Keeps only the biggest component not touching border of the image,
+// fragments of grid lines always touch it. Result is cropped to the component.
+func centralComponent(ink image.Gray) (image.Gray, bool) {
+	digit, _, ok := centralComponentBox(ink)
+	return digit, ok
+}
+
+// Works like centralComponent, also returns where the component is in the image
+func centralComponentBox(ink image.Gray) (image.Gray, image.Rectangle, bool) {
+	width, height := ink.Bounds().Max.X, ink.Bounds().Max.Y
+	labels, components := connectedComponents(ink)
+
+	boxes := make([]image.Rectangle, len(components)+1, len(components)+1)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			label := labels[y*width+x]
+			if label == 0 {
+				continue
+			}
+			pixel := image.Rect(x, y, x+1, y+1)
+			if boxes[label].Empty() {
+				boxes[label] = pixel
+			} else {
+				boxes[label] = boxes[label].Union(pixel)
+			}
+		}
+	}
+
+	best := component{}
+	for _, comp := range components {
+		box := boxes[comp.Label]
+		if box.Min.X == 0 || box.Min.Y == 0 || box.Max.X == width || box.Max.Y == height {
+			continue
+		}
+		if comp.Size > best.Size {
+			best = comp
+		}
+	}
+
+	if float64(best.Size) < minDigitArea*float64(width*height) {
+		return image.Gray{}, image.Rectangle{}, false
+	}
+
+	box := boxes[best.Label]
+	digit := *image.NewGray(image.Rect(0, 0, box.Dx(), box.Dy()))
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if labels[y*width+x] == best.Label {
+				digit.Pix[digit.PixOffset(x-box.Min.X, y-box.Min.Y)] = ink.Pix[ink.PixOffset(x, y)]
+			}
+		}
+	}
+	return digit, box, true
+}
+
+// Centre of mass of the image, pixel intensity is its weight
+func centreOfMass(img image.Gray) (pointF, float64) {
+	var centre pointF
+	mass := 0.0
+	for y := 0; y < img.Bounds().Max.Y; y++ {
+		for x := 0; x < img.Bounds().Max.X; x++ {
+			weight := float64(img.Pix[img.PixOffset(x, y)])
+			centre.X += float64(x) * weight
+			centre.Y += float64(y) * weight
+			mass += weight
+		}
+	}
+	if mass == 0 {
+		return centre, 0
+	}
+	centre.X /= mass
+	centre.Y /= mass
+	return centre, mass
+}
+
+// Scales digit so it fits 20x20 box keeping aspect ratio,
+// then puts it into 28x28 image with centre of mass in the middle
+func fitDigit(digit image.Gray) image.Gray {
+	width, height := digit.Bounds().Dx(), digit.Bounds().Dy()
+	scale := float64(digitBoxSize) / float64(maxInt(width, height))
+	scaledW := maxInt(1, int(float64(width)*scale+0.5))
+	scaledH := maxInt(1, int(float64(height)*scale+0.5))
+
+	scaled := *image.NewGray(image.Rect(0, 0, scaledW, scaledH))
+	for y := 0; y < scaledH; y++ {
+		for x := 0; x < scaledW; x++ {
+			srcX := (float64(x)+0.5)/scale - 0.5
+			srcY := (float64(y)+0.5)/scale - 0.5
+			scaled.Pix[scaled.PixOffset(x, y)] = bilinearAt(digit, srcX, srcY)
+		}
+	}
+
+	centre, _ := centreOfMass(scaled)
+	middle := float64(digitImageSize-1) / 2
+	shiftX := int(math.Floor(middle - centre.X + 0.5))
+	shiftY := int(math.Floor(middle - centre.Y + 0.5))
+
+	fitted := *image.NewGray(image.Rect(0, 0, digitImageSize, digitImageSize))
+	for y := 0; y < scaledH; y++ {
+		for x := 0; x < scaledW; x++ {
+			pt := image.Point{x + shiftX, y + shiftY}
+			if pt.In(fitted.Bounds()) {
+				fitted.Pix[fitted.PixOffset(pt.X, pt.Y)] = scaled.Pix[scaled.PixOffset(x, y)]
+			}
+		}
+	}
+	return fitted
+}
+
+// Straightens slanted digit with shear computed from image moments,
+// centre of mass stays in place
+func deskew(img image.Gray) image.Gray {
+	centre, mass := centreOfMass(img)
+	if mass == 0 {
+		return img
+	}
+
+	var mu11, mu02 float64
+	for y := 0; y < img.Bounds().Max.Y; y++ {
+		for x := 0; x < img.Bounds().Max.X; x++ {
+			weight := float64(img.Pix[img.PixOffset(x, y)])
+			dy := float64(y) - centre.Y
+			mu11 += (float64(x) - centre.X) * dy * weight
+			mu02 += dy * dy * weight
+		}
+	}
+	if mu02 < 1e-2*mass {
+		return img // Flat, nothing to straighten
+	}
+	skew := mu11 / mu02
+
+	straight := *image.NewGray(img.Bounds())
+	for y := 0; y < img.Bounds().Max.Y; y++ {
+		for x := 0; x < img.Bounds().Max.X; x++ {
+			srcX := float64(x) + skew*(float64(y)-centre.Y)
+			straight.Pix[straight.PixOffset(x, y)] = bilinearAt(img, srcX, float64(y))
+		}
+	}
+	return straight
+}
+
+// White 28x28 image of empty cell
+func blankCell() image.Gray {
+	blank := *image.NewGray(image.Rect(0, 0, digitImageSize, digitImageSize))
+	for i := range blank.Pix {
+		blank.Pix[i] = 255
+	}
+	return blank
+}
+
+// Prepares cell image like digits in MNIST data set: removes grid lines and noise,
+// scales the digit to 20x20 box and centres it by mass in 28x28 image.
+// Result keeps polarity of the cell: dark digit on white background.
+// Returns false when there is no digit in the cell.
+func cleanCell(cell image.Gray, threshold uint8, deskewDigit bool) (image.Gray, bool) {
+	digit, ok := centralComponent(inkImage(cell, threshold))
+	if !ok {
+		return blankCell(), false
+	}
+	return cleanDigit(digit, deskewDigit), true
+}
+
+// Turns digit found by centralComponent into 28x28 image like cleanCell does
+func cleanDigit(digit image.Gray, deskewDigit bool) image.Gray {
+	fitted := fitDigit(digit)
+	if deskewDigit {
+		fitted = deskew(fitted)
+	}
+
+	clean := blankCell()
+	for i, ink := range fitted.Pix {
+		clean.Pix[i] = 255 - ink
+	}
+	return clean
+}
+
+// CleanCell prepares image of one cell, warped from the puzzle with fragments of grid
+// lines around, the same way cells are prepared for digit recognition (see Sudoku.Cells).
+// Returns false when there is no full size digit in the cell, e.g. only pencil marks.
+// Useful to build training data.
+func CleanCell(cell image.Gray) (image.Gray, bool) {
+	digit, ok := centralComponent(inkImage(cell, otsuValue(cell)))
+	if !ok || !isFullDigit(digit, cell) {
+		return blankCell(), false
+	}
+	return cleanDigit(digit, false), true
+}
@@ -0,0 +1,150 @@
+package sudoku
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// White 56x56 cell with grid line fragments on borders
+func drawCell() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 56, 56))
+	for i := range img.Pix {
+		img.Pix[i] = 240
+	}
+	for i := 0; i < 56; i++ {
+		img.Pix[img.PixOffset(i, 0)] = 10
+		img.Pix[img.PixOffset(i, 1)] = 10
+		img.Pix[img.PixOffset(0, i)] = 10
+	}
+	return img
+}
+
+func fillRect(img *image.Gray, r image.Rectangle, val uint8) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Pix[img.PixOffset(x, y)] = val
+		}
+	}
+}
+
+func TestInkImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	img.Pix = []uint8{10, 200, 255, 99}
+	ink := inkImage(*img, 100)
+	assert.Equal(t, []uint8{245, 0, 0, 156}, ink.Pix)
+}
+
+func TestCentralComponent(t *testing.T) {
+	img := drawCell()
+	fillRect(img, image.Rect(20, 10, 30, 40), 20) // Digit
+	fillRect(img, image.Rect(40, 40, 42, 42), 20) // Noise
+
+	digit, ok := centralComponent(inkImage(*img, 128))
+	assert.True(t, ok)
+	assert.Equal(t, image.Rect(0, 0, 10, 30), digit.Bounds())
+	assert.Equal(t, uint8(235), digit.Pix[0])
+
+	// Only grid lines
+	_, ok = centralComponent(inkImage(*drawCell(), 128))
+	assert.False(t, ok)
+}
+
+func TestCentreOfMass(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	img.Pix[img.PixOffset(2, 4)] = 100
+	img.Pix[img.PixOffset(6, 4)] = 100
+	img.Pix[img.PixOffset(4, 8)] = 200
+
+	centre, mass := centreOfMass(*img)
+	assert.Equal(t, 400.0, mass)
+	assert.InDelta(t, 4, centre.X, 0.0001)
+	assert.InDelta(t, 6, centre.Y, 0.0001)
+
+	_, mass = centreOfMass(*image.NewGray(image.Rect(0, 0, 3, 3)))
+	assert.Equal(t, 0.0, mass)
+}
+
+func TestFitDigit(t *testing.T) {
+	digit := image.NewGray(image.Rect(0, 0, 10, 40))
+	fillRect(digit, digit.Bounds(), 255)
+
+	fitted := fitDigit(*digit)
+	assert.Equal(t, image.Rect(0, 0, 28, 28), fitted.Bounds())
+
+	centre, _ := centreOfMass(fitted)
+	assert.InDelta(t, 13.5, centre.X, 0.5)
+	assert.InDelta(t, 13.5, centre.Y, 0.5)
+
+	// Longer side is 20px
+	rows := 0
+	for y := 0; y < 28; y++ {
+		if fitted.GrayAt(14, y).Y > 128 {
+			rows++
+		}
+	}
+	assert.Equal(t, 20, rows)
+}
+
+func TestDeskew(t *testing.T) {
+	// Stroke leaning to the right: x grows by 1 every 2 rows
+	img := image.NewGray(image.Rect(0, 0, 28, 28))
+	for y := 4; y < 24; y++ {
+		x := 9 + y/2
+		img.Pix[img.PixOffset(x, y)] = 255
+		img.Pix[img.PixOffset(x+1, y)] = 255
+	}
+
+	spread := func(img image.Gray) float64 {
+		centre, mass := centreOfMass(img)
+		variance := 0.0
+		for y := 0; y < 28; y++ {
+			for x := 0; x < 28; x++ {
+				dx := float64(x) - centre.X
+				variance += dx * dx * float64(img.Pix[img.PixOffset(x, y)])
+			}
+		}
+		return math.Sqrt(variance / mass)
+	}
+
+	straight := deskew(*img)
+	assert.True(t, spread(*img) > 2.5, "Spread before %v", spread(*img))
+	assert.True(t, spread(straight) < 1, "Spread after %v", spread(straight))
+
+	before, _ := centreOfMass(*img)
+	after, _ := centreOfMass(straight)
+	assert.InDelta(t, before.X, after.X, 0.5)
+	assert.InDelta(t, before.Y, after.Y, 0.5)
+}
+
+func TestCleanCell(t *testing.T) {
+	img := drawCell()
+	fillRect(img, image.Rect(30, 8, 36, 48), 20)
+
+	clean, ok := cleanCell(*img, 128, true)
+	assert.True(t, ok)
+	assert.Equal(t, image.Rect(0, 0, 28, 28), clean.Bounds())
+	assert.Equal(t, uint8(255), clean.GrayAt(0, 0).Y) // Grid lines removed
+	assert.True(t, clean.GrayAt(14, 14).Y < 50)       // Digit in the middle
+
+	empty, ok := cleanCell(*drawCell(), 128, false)
+	assert.False(t, ok)
+	assert.Equal(t, uint8(255), empty.GrayAt(14, 14).Y)
+}
+
+func TestCleanCellExported(t *testing.T) {
+	img := drawCell()
+	fillRect(img, image.Rect(30, 8, 36, 48), 20)
+
+	clean, ok := CleanCell(*img)
+	assert.True(t, ok)
+	expected, _ := cleanCell(*img, otsuValue(*img), false)
+	assert.Equal(t, expected.Pix, clean.Pix)
+
+	_, ok = CleanCell(*drawPencilMarks())
+	assert.False(t, ok)
+	_, ok = CleanCell(*drawCell())
+	assert.False(t, ok)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mrfuxi/sudoku"
+)
+
+// Label of empty cell in IDX files, train skips it
+const blankLabel = 10
+
+var errInvalidAnnotation = errors.New("Invalid annotation")
+
+// Ground truth of a photo
+type annotation struct {
+	Board [][]int // 0 for blank cell
+	// Handwritten tells which digits are written by hand, nil when it's not annotated
+	Handwritten [][]bool
+}
+
+// Reads ground truth of a photo: line per row, character per cell,
+// digits 1-9, blank cells as '.' or '0'. Blank cells are returned as 0.
+// Rows of the board can be followed by the same number of rows telling
+// how digits are written: 'p' printed, 'h' handwritten, '.' blank.
+func readAnnotation(fileName string) (annotation, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return annotation{}, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return annotation{}, err
+	}
+	if len(lines) == 0 {
+		return annotation{}, errInvalidAnnotation
+	}
+
+	size := len(lines[0])
+	if len(lines) != size && len(lines) != 2*size {
+		return annotation{}, errInvalidAnnotation
+	}
+
+	var a annotation
+	for _, line := range lines[:size] {
+		if len(line) != size {
+			return annotation{}, errInvalidAnnotation
+		}
+		row := make([]int, size, size)
+		for i, char := range line {
+			switch {
+			case char == '.':
+				row[i] = 0
+			case char >= '0' && char <= '9':
+				row[i] = int(char - '0')
+			default:
+				return annotation{}, errInvalidAnnotation
+			}
+		}
+		a.Board = append(a.Board, row)
+	}
+
+	for r, line := range lines[size:] {
+		if len(line) != size {
+			return annotation{}, errInvalidAnnotation
+		}
+		row := make([]bool, size, size)
+		for i, char := range line {
+			digit := a.Board[r][i] != 0
+			switch {
+			case char == '.' && !digit:
+			case char == 'p' && digit:
+			case char == 'h' && digit:
+				row[i] = true
+			default:
+				return annotation{}, errInvalidAnnotation
+			}
+		}
+		a.Handwritten = append(a.Handwritten, row)
+	}
+	return a, nil
+}
+
+func cellLabel(digit int) string {
+	if digit == 0 {
+		return "blank"
+	}
+	return strconv.Itoa(digit)
+}
+
+// Cell as MNIST image: row by row, bright digit on black
+func mnistPixels(cell image.Gray) []uint8 {
+	pixels := make([]uint8, 28*28, 28*28)
+	for y := 0; y < 28; y++ {
+		for x := 0; x < 28; x++ {
+			pixels[y*28+x] = 255 - cell.GrayAt(x, y).Y
+		}
+	}
+	return pixels
+}
+
+// Writes extracted cells of annotated photos as data set for training:
+// sudoku export -photos Dir -out Dir [-idx]
+// Every photo (.png or .jpg) needs annotation in .txt file with the same name.
+// Features of digits with annotated way of writing go to writing.csv, see fitwriting.
+func exportDataset(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	var photosDir = flags.String("photos", "", "folder with annotated photos")
+	var out = flags.String("out", "", "folder to write data set to")
+	var idx = flags.Bool("idx", false, "write IDX files instead of cell images in sub folders named after digits")
+	var gnnFile = flags.String("gnn", "", "grid neural network, only used to draw debug grid.png")
+	flags.Parse(args)
+
+	if *photosDir == "" || *out == "" {
+		fmt.Println("Use -photos Dir -out Dir")
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(*out, os.ModePerm); err != nil {
+		log.Fatal(err)
+	}
+	if *gnnFile != "" {
+		sudoku.LoadGridNetwork(*gnnFile)
+	}
+
+	fileInfos, err := ioutil.ReadDir(*photosDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var images [][]uint8
+	var labels []uint8
+	var writing []writingRecord
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		ext := path.Ext(name)
+		if ext != ".png" && ext != ".jpg" {
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+
+		a, err := readAnnotation(path.Join(*photosDir, base+".txt"))
+		if err != nil {
+			log.Printf("%v: skipped, %v\n", name, err)
+			continue
+		}
+		size, ok := sudoku.GridSizes[len(a.Board)]
+		if !ok {
+			log.Printf("%v: skipped, unsupported size %v\n", name, len(a.Board))
+			continue
+		}
+
+		file, err := os.Open(path.Join(*photosDir, name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		img, _, err := sudoku.DecodeImage(file)
+		file.Close()
+		if err != nil {
+			log.Printf("%v: skipped, %v\n", name, err)
+			continue
+		}
+
+		s, err := sudoku.NewSudokuWithOptions(img, sudoku.Options{Size: size})
+		if err != nil {
+			log.Printf("%v: skipped, %v\n", name, err)
+			continue
+		}
+
+		if a.Handwritten != nil {
+			records, err := writingRecords(name, s, a)
+			if err != nil {
+				log.Printf("%v: digits skipped, %v\n", name, err)
+			}
+			writing = append(writing, records...)
+		}
+
+		for row, cells := range s.Cells() {
+			for col := range cells {
+				digit := a.Board[row][col]
+				if *idx {
+					label := uint8(digit)
+					if digit == 0 {
+						label = blankLabel
+					}
+					images = append(images, mnistPixels(cells[col]))
+					labels = append(labels, label)
+					continue
+				}
+
+				dir := path.Join(*out, cellLabel(digit))
+				if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+					log.Fatal(err)
+				}
+				fileName := path.Join(dir, fmt.Sprintf("%v_%v_%v.png", base, row, col))
+				if err := savePNG(&cells[col], fileName); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		fmt.Printf("%v: exported %v cells\n", name, size.Cells*size.Cells)
+	}
+
+	if len(writing) != 0 {
+		file, err := os.Create(path.Join(*out, "writing.csv"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writeWritingRecords(file, writing)
+		file.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *idx {
+		if err := writeIDXImages(path.Join(*out, "images-idx3-ubyte"), images); err != nil {
+			log.Fatal(err)
+		}
+		if err := writeIDXLabels(path.Join(*out, "labels-idx1-ubyte"), labels); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
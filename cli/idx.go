@@ -0,0 +1,148 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	idxImagesMagic = 0x00000803
+	idxLabelsMagic = 0x00000801
+	idxImageSize   = 28 * 28
+	maxPrealloc    = 1 << 16 // Count in header is not trusted, memory grows with data actually read
+)
+
+var errInvalidIDX = errors.New("Invalid IDX file")
+
+// Opens file, gzipped files (.gz) are decompressed on the fly.
+// Returns size of the data, -1 when it's not known up front.
+func openData(fileName string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !strings.HasSuffix(fileName, ".gz") {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+		return file, info.Size(), nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, -1, nil
+}
+
+// Checks that header count of items fits in the data
+func validCount(count uint32, itemSize, headerSize, dataSize int64) bool {
+	return dataSize < 0 || int64(count)*itemSize <= dataSize-headerSize
+}
+
+// Reads MNIST images, every image is 28x28 pixels row by row
+func readIDXImages(fileName string) ([][]uint8, error) {
+	reader, size, err := openData(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var header [4]uint32 // Magic, count, rows, cols
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header[0] != idxImagesMagic || header[2] != 28 || header[3] != 28 {
+		return nil, errInvalidIDX
+	}
+	if !validCount(header[1], idxImageSize, 16, size) {
+		return nil, errInvalidIDX
+	}
+
+	prealloc := int(header[1])
+	if prealloc > maxPrealloc {
+		prealloc = maxPrealloc
+	}
+	images := make([][]uint8, 0, prealloc)
+	for i := uint32(0); i < header[1]; i++ {
+		img := make([]uint8, idxImageSize, idxImageSize)
+		if _, err := io.ReadFull(reader, img); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// Reads MNIST labels
+func readIDXLabels(fileName string) ([]uint8, error) {
+	reader, size, err := openData(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var header [2]uint32 // Magic, count
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header[0] != idxLabelsMagic || !validCount(header[1], 1, 8, size) {
+		return nil, errInvalidIDX
+	}
+
+	labels, err := ioutil.ReadAll(io.LimitReader(reader, int64(header[1])))
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) != int(header[1]) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return labels, nil
+}
+
+// Writes MNIST-style images, every image is 28x28 pixels row by row
+func writeIDXImages(fileName string, images [][]uint8) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := [4]uint32{idxImagesMagic, uint32(len(images)), 28, 28}
+	if err := binary.Write(file, binary.BigEndian, header); err != nil {
+		return err
+	}
+	for _, img := range images {
+		if _, err := file.Write(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes MNIST-style labels
+func writeIDXLabels(fileName string, labels []uint8) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := [2]uint32{idxLabelsMagic, uint32(len(labels))}
+	if err := binary.Write(file, binary.BigEndian, header); err != nil {
+		return err
+	}
+	_, err = file.Write(labels)
+	return err
+}
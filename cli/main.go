@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"image"
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io/ioutil"
 	"log"
 	"os"
@@ -15,7 +15,6 @@ import (
 
 	"github.com/mrfuxi/sudoku"
 	"github.com/mrfuxi/sudoku/digits"
-	"github.com/mrfuxi/sudoku/nngrid"
 )
 
 const (
@@ -30,28 +29,75 @@ func getExampleImage(name string) (image.Image, error) {
 		log.Fatalln(err)
 	}
 
-	img, _, err := image.Decode(reader)
+	defer reader.Close()
+
+	img, _, err := sudoku.DecodeImage(reader)
 	return img, err
 }
 
-func findSudoku(filename string, debug bool) (sudoku.Sudoku, error) {
+func saveImage(img image.Image, name string) error {
+	return savePNG(img, path.Join(saveLocation, name))
+}
+
+func savePNG(img image.Image, fileName string) error {
+	outfile, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	return png.Encode(outfile, img)
+}
+
+func findSudoku(filename string, debug bool, size sudoku.GridSize) (sudoku.Sudoku, error) {
 	img, err := getExampleImage(filename)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	return sudoku.NewSudoku(img)
+	s, err := sudoku.NewSudokuWithOptions(img, sudoku.Options{Size: size})
+	if debug && s != nil {
+		// Stages are saved also when sudoku was not found
+		stages := s.Stages()
+		for i := range stages {
+			name := fmt.Sprintf("%v_stage_%v.png", strings.TrimSuffix(filename, path.Ext(filename)), i)
+			if err := saveImage(&stages[i], name); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	return s, err
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "train":
+			train(os.Args[2:])
+			return
+		case "export":
+			exportDataset(os.Args[2:])
+			return
+		case "evaluate":
+			evaluate(os.Args[2:])
+			return
+		case "synth":
+			synth(os.Args[2:])
+			return
+		case "fitwriting":
+			fitWriting(os.Args[2:])
+			return
+		}
+	}
+
 	os.RemoveAll(saveLocation)
 	os.MkdirAll(saveLocation, os.ModePerm)
 
 	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	var debug = flag.Bool("debug", false, "prepare debug images")
 	var file = flag.String("file", "", "file to process")
-	var nnFile = flag.String("nn", "", "neural network")
-	var gnnFile = flag.String("gnn", "", "grid neural network")
+	var nnFile = flag.String("nn", "", "neural network, embedded one is used by default")
+	var gnnFile = flag.String("gnn", "", "grid neural network, only used to draw debug grid.png")
+	var cells = flag.Int("size", 9, "number of cells in a row: 4, 6, 9, 12 or 16 (12 and 16 locate the grid only)")
 
 	flag.Parse()
 	if *cpuprofile != "" {
@@ -63,19 +109,27 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	size, ok := sudoku.GridSizes[*cells]
+	if !ok {
+		fmt.Println("Unsupported size of sudoku. Use -size 4, 6, 9, 12 or 16")
+		os.Exit(1)
+	}
+	if size.Cells > 9 {
+		fmt.Println("Only the grid is located, digits above 9 are not recognised")
+	}
+
 	var s sudoku.Sudoku
 	var err error
 
-	if *nnFile == "" {
-		fmt.Println("Neural network file not provided. Use -nn FileName")
-		os.Exit(1)
+	if *nnFile != "" {
+		digits.LoadNetwork(*nnFile)
+	}
+	if *gnnFile != "" {
+		sudoku.LoadGridNetwork(*gnnFile)
 	}
-
-	digits.LoadNetwork(*nnFile)
-	nngrid.LoadNetwork(*gnnFile)
 
 	if *file != "" {
-		s, err = findSudoku(*file, *debug)
+		s, err = findSudoku(*file, *debug, size)
 	} else {
 		fileInfos, err := ioutil.ReadDir(exampleDir)
 		if err != nil {
@@ -83,7 +137,7 @@ func main() {
 		}
 		for _, fileInfo := range fileInfos {
 			if strings.HasSuffix(fileInfo.Name(), ".png") || strings.HasSuffix(fileInfo.Name(), ".jpg") {
-				s, err = findSudoku(fileInfo.Name(), *debug)
+				s, err = findSudoku(fileInfo.Name(), *debug, size)
 			}
 		}
 	}
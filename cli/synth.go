@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/mrfuxi/sudoku"
+)
+
+// Size of rendered cell, same as cells warped from photos
+const synthCellSize = 56
+
+type glyphPoint struct{ X, Y float64 }
+
+// Strokes of a digit drawn in unit box, x to the right and y down
+type glyph [][]glyphPoint
+
+// Points of elliptical arc, angles in degrees, 90 is down
+func arc(cx, cy, rx, ry, from, to float64) []glyphPoint {
+	steps := int(math.Abs(to-from)/10) + 1
+	points := make([]glyphPoint, steps+1, steps+1)
+	for i := range points {
+		angle := (from + (to-from)*float64(i)/float64(steps)) * math.Pi / 180
+		points[i] = glyphPoint{cx + rx*math.Cos(angle), cy + ry*math.Sin(angle)}
+	}
+	return points
+}
+
+// Points of quadratic Bezier curve
+func curve(a, control, b glyphPoint) []glyphPoint {
+	points := make([]glyphPoint, 11, 11)
+	for i := range points {
+		t := float64(i) / 10
+		points[i] = glyphPoint{
+			(1-t)*(1-t)*a.X + 2*(1-t)*t*control.X + t*t*b.X,
+			(1-t)*(1-t)*a.Y + 2*(1-t)*t*control.Y + t*t*b.Y,
+		}
+	}
+	return points
+}
+
+// Glyph turned upside down, 6 becomes 9
+func rotated(g glyph) glyph {
+	r := make(glyph, len(g), len(g))
+	for i, stroke := range g {
+		r[i] = make([]glyphPoint, len(stroke), len(stroke))
+		for j, p := range stroke {
+			r[i][j] = glyphPoint{1 - p.X, 1 - p.Y}
+		}
+	}
+	return r
+}
+
+func join(parts ...[]glyphPoint) []glyphPoint {
+	var points []glyphPoint
+	for _, part := range parts {
+		points = append(points, part...)
+	}
+	return points
+}
+
+// Common ways of writing every digit, both printed and by hand
+var glyphs = [10][]glyph{
+	{
+		{arc(0.5, 0.5, 0.32, 0.45, 0, 360)},
+		{arc(0.5, 0.5, 0.28, 0.46, -90, 275)},
+	},
+	{
+		{{{0.5, 0.05}, {0.5, 0.95}}},
+		{{{0.28, 0.25}, {0.52, 0.05}, {0.52, 0.95}}},
+		{{{0.28, 0.25}, {0.52, 0.05}, {0.52, 0.95}}, {{0.28, 0.95}, {0.76, 0.95}}},
+	},
+	{
+		{join(arc(0.5, 0.3, 0.3, 0.25, 190, 380), []glyphPoint{{0.18, 0.95}, {0.84, 0.95}})},
+		{join(arc(0.5, 0.28, 0.3, 0.23, 200, 360), curve(glyphPoint{0.8, 0.28}, glyphPoint{0.75, 0.6}, glyphPoint{0.18, 0.95}), []glyphPoint{{0.84, 0.93}})},
+		{join(arc(0.5, 0.27, 0.3, 0.22, 160, 370), curve(glyphPoint{0.79, 0.35}, glyphPoint{0.35, 0.65}, glyphPoint{0.2, 0.93}), curve(glyphPoint{0.2, 0.93}, glyphPoint{0.3, 0.82}, glyphPoint{0.45, 0.9}), []glyphPoint{{0.85, 0.95}})},
+	},
+	{
+		{join(arc(0.5, 0.28, 0.28, 0.23, 200, 450), arc(0.5, 0.73, 0.32, 0.23, 270, 520))},
+		{join([]glyphPoint{{0.2, 0.05}, {0.78, 0.05}, {0.45, 0.42}}, arc(0.5, 0.7, 0.32, 0.26, 260, 520))},
+		{join(arc(0.45, 0.27, 0.3, 0.22, 200, 420), arc(0.45, 0.72, 0.35, 0.23, 270, 500))},
+	},
+	{
+		{{{0.66, 0.95}, {0.66, 0.05}, {0.14, 0.68}, {0.86, 0.68}}},
+		{{{0.32, 0.05}, {0.2, 0.62}, {0.86, 0.62}}, {{0.66, 0.3}, {0.66, 0.95}}},
+	},
+	{
+		{join([]glyphPoint{{0.8, 0.05}, {0.3, 0.05}, {0.26, 0.46}}, arc(0.5, 0.68, 0.31, 0.27, 225, 515))},
+		{join([]glyphPoint{{0.3, 0.05}, {0.26, 0.46}}, arc(0.5, 0.68, 0.31, 0.27, 225, 515)), {{0.3, 0.05}, {0.8, 0.05}}},
+		{join([]glyphPoint{{0.82, 0.05}, {0.3, 0.05}, {0.22, 0.5}}, curve(glyphPoint{0.22, 0.5}, glyphPoint{0.5, 0.32}, glyphPoint{0.78, 0.55}), arc(0.45, 0.7, 0.35, 0.25, 0, 150))},
+	},
+	sixes,
+	{
+		{{{0.15, 0.05}, {0.85, 0.05}, {0.4, 0.95}}},
+		{{{0.15, 0.05}, {0.85, 0.05}, {0.4, 0.95}}, {{0.35, 0.5}, {0.78, 0.5}}},
+		{join([]glyphPoint{{0.15, 0.12}, {0.15, 0.05}, {0.85, 0.05}}, curve(glyphPoint{0.85, 0.05}, glyphPoint{0.5, 0.45}, glyphPoint{0.45, 0.95}))},
+	},
+	{
+		{arc(0.5, 0.27, 0.25, 0.22, 0, 360), arc(0.5, 0.72, 0.31, 0.24, 0, 360)},
+		{join(arc(0.5, 0.27, 0.25, 0.22, 90, 450), arc(0.5, 0.72, 0.31, 0.24, 270, 630))},
+	},
+	append([]glyph{
+		{join(arc(0.5, 0.3, 0.3, 0.25, 0, 360), []glyphPoint{{0.8, 0.3}, {0.74, 0.95}})},
+		{join(arc(0.5, 0.3, 0.3, 0.25, 0, 360), curve(glyphPoint{0.8, 0.3}, glyphPoint{0.8, 0.95}, glyphPoint{0.26, 0.9}))},
+	}, rotated(sixes[0]), rotated(sixes[2]), rotated(sixes[3])),
+}
+
+var sixes = []glyph{
+	{join(curve(glyphPoint{0.74, 0.05}, glyphPoint{0.18, 0.2}, glyphPoint{0.2, 0.7}), arc(0.5, 0.7, 0.3, 0.25, 180, 540))},
+	{join([]glyphPoint{{0.68, 0.05}, {0.24, 0.62}}, arc(0.5, 0.72, 0.3, 0.23, 200, 560))},
+	// Printed, hook from the top right
+	{join(arc(0.5, 0.5, 0.3, 0.45, -35, -180), arc(0.5, 0.7, 0.3, 0.25, 180, 540))},
+	{join(arc(0.52, 0.45, 0.3, 0.4, -50, -180), arc(0.5, 0.68, 0.32, 0.27, 170, 530))},
+}
+
+// Distance from point p to segment ab
+func segmentDistance(px, py float64, a, b glyphPoint) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, ((px-a.X)*dx+(py-a.Y)*dy)/length))
+	}
+	x, y := a.X+t*dx-px, a.Y+t*dy-py
+	return math.Sqrt(x*x + y*y)
+}
+
+// Renders random variant of the digit in a cell with fragments of grid lines around,
+// like cells warped from photos
+func renderCell(digit int, rnd *rand.Rand) image.Gray {
+	size := float64(synthCellSize)
+	variants := glyphs[digit]
+	g := variants[rnd.Intn(len(variants))]
+
+	// Affine transformation of unit box into the cell
+	height := size * (0.45 + 0.3*rnd.Float64())
+	width := height * (0.45 + 0.35*rnd.Float64())
+	angle := (rnd.Float64()*2 - 1) * 10 * math.Pi / 180
+	shear := (rnd.Float64()*2 - 1) * 0.25
+	cx := size/2 + (rnd.Float64()*2-1)*size*0.06
+	cy := size/2 + (rnd.Float64()*2-1)*size*0.06
+	jitter := rnd.Float64() * 0.03 // Hand writing is not exact
+	// Smooth random warp, so parts of the digit differ in size
+	warpX, warpY := rnd.Float64()*0.08, rnd.Float64()*0.08
+	phaseX, phaseY := rnd.Float64()*2*math.Pi, rnd.Float64()*2*math.Pi
+	transform := func(p glyphPoint) glyphPoint {
+		u := p.X + warpX*math.Sin(2*math.Pi*p.Y+phaseX)
+		v := p.Y + warpY*math.Sin(2*math.Pi*p.X+phaseY)
+		x := (u - 0.5 + (rnd.Float64()*2-1)*jitter) * width
+		y := (v - 0.5 + (rnd.Float64()*2-1)*jitter) * height
+		x += shear * y
+		return glyphPoint{
+			cx + x*math.Cos(angle) - y*math.Sin(angle),
+			cy + x*math.Sin(angle) + y*math.Cos(angle),
+		}
+	}
+	strokes := make([][]glyphPoint, len(g), len(g))
+	for i, stroke := range g {
+		strokes[i] = make([]glyphPoint, len(stroke), len(stroke))
+		for j, p := range stroke {
+			strokes[i][j] = transform(p)
+		}
+	}
+
+	background := 150 + 100*rnd.Float64()
+	ink := (background - 80) * rnd.Float64()
+	stroke := height * (0.06 + 0.1*rnd.Float64())
+
+	cell := *image.NewGray(image.Rect(0, 0, synthCellSize, synthCellSize))
+	lineWidth := 1 + 3*rnd.Float64()
+	lineShift := [4]float64{}
+	for i := range lineShift {
+		lineShift[i] = 3 * rnd.Float64()
+	}
+	noise := 10 * rnd.Float64()
+	for y := 0; y < synthCellSize; y++ {
+		for x := 0; x < synthCellSize; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			distance := math.Inf(1)
+			for _, s := range strokes {
+				for i := 1; i < len(s); i++ {
+					distance = math.Min(distance, segmentDistance(px, py, s[i-1], s[i]))
+				}
+			}
+			// Anti-aliased stroke
+			coverage := math.Max(0, math.Min(1, stroke/2-distance+0.5))
+
+			// Grid lines along borders
+			border := math.Min(math.Min(px-lineShift[0], size-lineShift[1]-px), math.Min(py-lineShift[2], size-lineShift[3]-py))
+			coverage = math.Max(coverage, math.Max(0, math.Min(1, lineWidth-border+0.5)))
+
+			value := background*(1-coverage) + ink*coverage + rnd.NormFloat64()*noise
+			cell.Pix[cell.PixOffset(x, y)] = uint8(math.Max(0, math.Min(255, value)))
+		}
+	}
+	return cell
+}
+
+// Writes synthetic cells, cleaned like cells of photos, into sub folders named after digits:
+// sudoku synth -out Dir [-count N] [-seed N]
+func synth(args []string) {
+	flags := flag.NewFlagSet("synth", flag.ExitOnError)
+	var out = flags.String("out", "", "folder to write cell images to")
+	var count = flags.Int("count", 1000, "number of cells of every digit")
+	var seed = flags.Int64("seed", 1, "seed of random generator")
+	flags.Parse(args)
+
+	if *out == "" {
+		fmt.Println("Use -out Dir")
+		os.Exit(1)
+	}
+
+	rnd := rand.New(rand.NewSource(*seed))
+	for digit := 0; digit < 10; digit++ {
+		digitDir := path.Join(*out, strconv.Itoa(digit))
+		if err := os.MkdirAll(digitDir, os.ModePerm); err != nil {
+			log.Fatal(err)
+		}
+
+		written := 0
+		for written < *count {
+			clean, ok := sudoku.CleanCell(renderCell(digit, rnd))
+			if !ok {
+				continue // Digit merged with grid lines
+			}
+			if err := savePNG(&clean, path.Join(digitDir, fmt.Sprintf("%05d.png", written))); err != nil {
+				log.Fatal(err)
+			}
+			written++
+		}
+	}
+	fmt.Printf("%v cells of every digit written to %v\n", *count, *out)
+}
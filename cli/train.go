@@ -0,0 +1,281 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mrfuxi/neural"
+	"github.com/mrfuxi/sudoku"
+	"github.com/mrfuxi/sudoku/digits"
+)
+
+func oneHot(digit int) []float64 {
+	output := make([]float64, 10, 10)
+	output[digit] = 1
+	return output
+}
+
+func mnistExamples(imagesFile, labelsFile string) ([]neural.TrainExample, error) {
+	images, err := readIDXImages(imagesFile)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := readIDXLabels(labelsFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) != len(labels) {
+		return nil, errInvalidIDX
+	}
+
+	examples := make([]neural.TrainExample, 0, len(images))
+	for i := range images {
+		if labels[i] > 9 {
+			continue // Blank cell
+		}
+		examples = append(examples, neural.TrainExample{
+			Input:  digits.InputFromMNIST(images[i]),
+			Output: oneHot(int(labels[i])),
+		})
+	}
+	return examples, nil
+}
+
+// Reads cell images from folders named after digits: dir/0/*.png ... dir/9/*.png,
+// images are prepared as input of network described by the manifest
+func cellExamples(dir string, m digits.Manifest) ([]neural.TrainExample, error) {
+	var examples []neural.TrainExample
+	for digit := 0; digit < 10; digit++ {
+		digitDir := path.Join(dir, strconv.Itoa(digit))
+		fileInfos, err := ioutil.ReadDir(digitDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fileInfo := range fileInfos {
+			if !strings.HasSuffix(fileInfo.Name(), ".png") {
+				continue
+			}
+
+			file, err := os.Open(path.Join(digitDir, fileInfo.Name()))
+			if err != nil {
+				return nil, err
+			}
+			img, _, err := sudoku.DecodeImage(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", fileInfo.Name(), err)
+			}
+
+			gray := image.NewGray(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+			draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+			input, err := m.Input(*gray)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", fileInfo.Name(), err)
+			}
+			examples = append(examples, neural.TrainExample{Input: input, Output: oneHot(digit)})
+		}
+	}
+	return examples, nil
+}
+
+// Fraction of examples recognised correctly, output of the network is mapped
+// through labels of the manifest. Examples are labelled with one-hot digits.
+func accuracy(nn digits.Recogniser, m digits.Manifest, examples []neural.TrainExample) float64 {
+	if len(examples) == 0 {
+		return 0
+	}
+
+	correct := 0
+	for _, example := range examples {
+		class, _ := digits.Probabilities(nn.Evaluate(example.Input)).Best()
+		digit := m.Digit(class)
+		expected, _ := digits.Probabilities(example.Output).Best()
+		if digit == expected {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(examples))
+}
+
+// Reads examples from MNIST files and/or folder with cell images
+func readExamples(mnistImages, mnistLabels, cellsDir string, m digits.Manifest) ([]neural.TrainExample, error) {
+	var examples []neural.TrainExample
+	if mnistImages != "" || mnistLabels != "" {
+		mnist, err := mnistExamples(mnistImages, mnistLabels)
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, mnist...)
+	}
+	if cellsDir != "" {
+		cells, err := cellExamples(cellsDir, m)
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, cells...)
+	}
+	return examples, nil
+}
+
+// Trains digit network: sudoku train -out FileName [-model mlp|cnn] [-mnist-images File -mnist-labels File] [-cells Dir].
+// Architecture of the network is saved in the model file.
+func train(args []string) {
+	flags := flag.NewFlagSet("train", flag.ExitOnError)
+	var out = flags.String("out", "", "file to save trained network to")
+	var mnistImages = flags.String("mnist-images", "", "MNIST images in IDX format, can be gzipped")
+	var mnistLabels = flags.String("mnist-labels", "", "MNIST labels in IDX format, can be gzipped")
+	var cellsDir = flags.String("cells", "", "folder with cell images in sub folders named after digits")
+	var epochs = flags.Int("epochs", 10, "number of epochs")
+	var batchSize = flags.Int("batch", 10, "size of mini batch")
+	var learningRate = flags.Float64("rate", 0.5, "learning rate")
+	var validation = flags.Float64("validation", 0.1, "fraction of examples used for validation")
+	var hidden = flags.String("hidden", "100", "sizes of hidden layers of mlp, comma separated")
+	var model = flags.String("model", digits.KindMLP, "type of network: mlp or cnn")
+	flags.Parse(args)
+
+	manifest := digits.DefaultManifest
+	switch *model {
+	case digits.KindMLP:
+		manifest.Layers = []int{digits.InputSize}
+		manifest.Activators = nil
+		for _, size := range strings.Split(*hidden, ",") {
+			neurons, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil || neurons <= 0 {
+				fmt.Println("Invalid size of hidden layer:", size)
+				os.Exit(1)
+			}
+			manifest.Layers = append(manifest.Layers, neurons)
+			manifest.Activators = append(manifest.Activators, "sigmoid")
+		}
+		manifest.Layers = append(manifest.Layers, len(manifest.Labels))
+		manifest.Activators = append(manifest.Activators, "softmax")
+	case digits.KindCNN:
+		config := digits.DefaultCNNConfig
+		manifest.Kind = digits.KindCNN
+		manifest.Layers, manifest.Activators = nil, nil
+		manifest.CNN = &config
+	default:
+		fmt.Println("Unknown model:", *model)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		fmt.Println("Output file not provided. Use -out FileName")
+		os.Exit(1)
+	}
+
+	examples, err := readExamples(*mnistImages, *mnistLabels, *cellsDir, manifest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(examples) == 0 {
+		fmt.Println("No training data. Use -mnist-images and -mnist-labels or -cells Dir")
+		os.Exit(1)
+	}
+
+	rand.Seed(1)
+	for i := range examples {
+		j := rand.Intn(i + 1)
+		examples[i], examples[j] = examples[j], examples[i]
+	}
+	split := len(examples) - int(float64(len(examples))**validation)
+	trainSet, validationSet := examples[:split], examples[split:]
+	fmt.Printf("Training on %v examples, validating on %v\n", len(trainSet), len(validationSet))
+
+	var nn digits.Recogniser
+	if manifest.Kind == digits.KindCNN {
+		cnn, err := digits.NewCNNFromManifest(manifest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rnd := rand.New(rand.NewSource(1))
+		for epoch := 1; epoch <= *epochs; epoch++ {
+			loss := cnn.TrainEpoch(trainSet, *learningRate, *batchSize, rnd)
+			fmt.Printf("Epoch %v: loss %.4f, validation accuracy %.2f%%\n", epoch, loss, 100*accuracy(cnn, manifest, validationSet))
+		}
+		nn = cnn
+	} else {
+		mlp, err := digits.NewNetworkFromManifest(manifest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for epoch := 1; epoch <= *epochs; epoch++ {
+			neural.Train(mlp, trainSet, neural.TrainOptions{
+				Epochs:         1,
+				MiniBatchSize:  *batchSize,
+				LearningRate:   *learningRate,
+				TrainerFactory: neural.NewBackpropagationTrainer,
+				Cost:           neural.NewCrossEntropyCost(),
+			})
+			fmt.Printf("Epoch %v: validation accuracy %.2f%%\n", epoch, 100*accuracy(mlp, manifest, validationSet))
+		}
+		nn = mlp
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	if err := digits.SaveNetwork(file, nn, manifest); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Network saved to", *out)
+}
+
+// Compares accuracy of saved networks on the same examples:
+// sudoku evaluate -models File,File [-mnist-images File -mnist-labels File] [-cells Dir]
+func evaluate(args []string) {
+	flags := flag.NewFlagSet("evaluate", flag.ExitOnError)
+	var models = flags.String("models", "", "model files, comma separated")
+	var mnistImages = flags.String("mnist-images", "", "MNIST images in IDX format, can be gzipped")
+	var mnistLabels = flags.String("mnist-labels", "", "MNIST labels in IDX format, can be gzipped")
+	var cellsDir = flags.String("cells", "", "folder with cell images in sub folders named after digits")
+	flags.Parse(args)
+
+	if *models == "" {
+		fmt.Println("Use -models File,File")
+		os.Exit(1)
+	}
+	examples, err := readExamples(*mnistImages, *mnistLabels, *cellsDir, digits.DefaultManifest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(examples) == 0 {
+		fmt.Println("No data. Use -mnist-images and -mnist-labels or -cells Dir")
+		os.Exit(1)
+	}
+
+	for _, fileName := range strings.Split(*models, ",") {
+		file, err := os.Open(fileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		nn, manifest, err := digits.ReadNetwork(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("%v: %v", fileName, err)
+		}
+		if manifest.Kind == "" {
+			manifest.Kind = digits.KindMLP
+		}
+		if manifest.InputWidth != digits.DefaultManifest.InputWidth || manifest.InputHeight != digits.DefaultManifest.InputHeight {
+			fmt.Printf("%v: skipped, input is not 28x28\n", fileName)
+			continue
+		}
+		fmt.Printf("%v (%v): accuracy %.2f%% on %v examples\n", fileName, manifest.Kind, 100*accuracy(nn, manifest, examples), len(examples))
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/mrfuxi/sudoku"
+)
+
+// How a digit in annotated photo was written, data to fit handwriting weights
+type writingRecord struct {
+	Photo       string
+	Row, Col    int
+	Handwritten bool
+	Features    sudoku.WritingFeatures
+	Confidence  float64
+}
+
+var errInvalidRecord = errors.New("Invalid writing record")
+
+// Columns of writing.csv, inputs of logistic regression (see writingInput) go after handwritten
+var writingHeader = []string{"photo", "row", "col", "handwritten", "stroke_variation", "height", "height_deviation", "offset", "confidence"}
+
+// Records of digits recognised in annotated cells. Cells recognised as empty are left out,
+// they have no features.
+func writingRecords(photo string, s sudoku.Sudoku, a annotation) ([]writingRecord, error) {
+	recognised, err := s.Digits()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []writingRecord
+	for row := range a.Handwritten {
+		for col, handwritten := range a.Handwritten[row] {
+			if a.Board[row][col] == 0 || row >= len(recognised) || col >= len(recognised[row]) {
+				continue
+			}
+			cell := recognised[row][col]
+			if cell.Kind == sudoku.CellEmpty {
+				continue
+			}
+			records = append(records, writingRecord{
+				Photo:       photo,
+				Row:         row,
+				Col:         col,
+				Handwritten: handwritten,
+				Features:    cell.Writing,
+				Confidence:  cell.Confidence,
+			})
+		}
+	}
+	return records, nil
+}
+
+func writeWritingRecords(w io.Writer, records []writingRecord) error {
+	writer := csv.NewWriter(w)
+	writer.Write(writingHeader)
+	for _, r := range records {
+		row := []string{r.Photo, strconv.Itoa(r.Row), strconv.Itoa(r.Col), strconv.FormatBool(r.Handwritten)}
+		for _, input := range writingInput(r)[1:] {
+			row = append(row, strconv.FormatFloat(input, 'g', -1, 64))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func readWritingRecords(r io.Reader) ([]writingRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	records := make([]writingRecord, 0, len(rows)-1)
+	for _, row := range rows[1:] { // Header is skipped
+		if len(row) != len(writingHeader) {
+			return nil, errInvalidRecord
+		}
+		r := writingRecord{Photo: row[0]}
+		errs := make([]error, len(row), len(row))
+		r.Row, errs[1] = strconv.Atoi(row[1])
+		r.Col, errs[2] = strconv.Atoi(row[2])
+		r.Handwritten, errs[3] = strconv.ParseBool(row[3])
+		inputs := make([]float64, len(row)-4, len(row)-4)
+		for i := range inputs {
+			inputs[i], errs[4+i] = strconv.ParseFloat(row[4+i], 64)
+		}
+		for _, err := range errs {
+			if err != nil {
+				return nil, errInvalidRecord
+			}
+		}
+
+		r.Features = sudoku.WritingFeatures{
+			StrokeVariation: inputs[0],
+			Height:          inputs[1],
+			HeightDeviation: inputs[2],
+			Offset:          inputs[3],
+		}
+		r.Confidence = inputs[4]
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Inputs of logistic regression: bias and then the same order as columns of writing.csv
+func writingInput(r writingRecord) []float64 {
+	return []float64{
+		1,
+		r.Features.StrokeVariation,
+		r.Features.Height,
+		r.Features.HeightDeviation,
+		r.Features.Offset,
+		r.Confidence,
+	}
+}
+
+// Probability of the digit being handwritten, computed like in handwriting.go
+func writingProbability(weights []float64, r writingRecord) float64 {
+	score := 0.0
+	for i, input := range writingInput(r) {
+		score += weights[i] * input
+	}
+	return 1 / (1 + math.Exp(-score))
+}
+
+// Fits weights of logistic regression with gradient descent
+func fitLogistic(records []writingRecord, epochs int, rate float64) []float64 {
+	weights := make([]float64, len(writingHeader)-3, len(writingHeader)-3)
+	for epoch := 0; epoch < epochs; epoch++ {
+		gradient := make([]float64, len(weights), len(weights))
+		for _, r := range records {
+			err := writingProbability(weights, r)
+			if r.Handwritten {
+				err--
+			}
+			for i, input := range writingInput(r) {
+				gradient[i] += err * input
+			}
+		}
+		for i := range weights {
+			weights[i] -= rate * gradient[i] / float64(len(records))
+		}
+	}
+	return weights
+}
+
+// Fits weights of handwriting score to digits exported from annotated photos:
+// sudoku fitwriting -data File [-epochs N] [-rate R]
+// Prints constants for handwriting.go.
+func fitWriting(args []string) {
+	flags := flag.NewFlagSet("fitwriting", flag.ExitOnError)
+	var data = flags.String("data", "", "writing.csv written by export")
+	var epochs = flags.Int("epochs", 50000, "number of iterations of gradient descent")
+	var rate = flags.Float64("rate", 4, "learning rate")
+	flags.Parse(args)
+
+	if *data == "" {
+		fmt.Println("Use -data File")
+		os.Exit(1)
+	}
+
+	file, err := os.Open(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	records, err := readWritingRecords(file)
+	file.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(records) == 0 {
+		fmt.Println("No records to fit")
+		os.Exit(1)
+	}
+
+	weights := fitLogistic(records, *epochs, *rate)
+	correct := 0
+	for _, r := range records {
+		if (writingProbability(weights, r) > 0.5) == r.Handwritten {
+			correct++
+		}
+	}
+
+	fmt.Printf("Fitted on %v digits, accuracy %.2f%%\n", len(records), 100*float64(correct)/float64(len(records)))
+	names := []string{"handBias", "handStrokeWeight", "handHeightWeight", "handHeightDeviationWeight", "handOffsetWeight", "handConfidenceWeight"}
+	for i, name := range names {
+		fmt.Printf("%-25v = %.1f\n", name, weights[i])
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/mrfuxi/sudoku"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAnnotation(t *testing.T) {
+	a, err := readAnnotation(path.Join(exampleDir, "s1.txt"))
+	assert.Nil(t, err)
+	assert.Len(t, a.Board, 9)
+	assert.Equal(t, []int{6, 8, 5, 9, 4, 3, 2, 7, 1}, a.Board[0])
+	assert.Equal(t, []bool{false, false, false, true, true, true, true, true, true}, a.Handwritten[0])
+
+	a, err = readAnnotation(path.Join(exampleDir, "s2.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 0, 8, 0, 7, 0, 0, 4, 6}, a.Board[0])
+	assert.Equal(t, []bool{false, false, false, false, false, false, false, false, false}, a.Handwritten[0])
+
+	dir, err := ioutil.TempDir("", "annotation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		content string
+		err     error
+	}{
+		{"12\n.1\n", nil},
+		{"12\n.1\n\nph\n.h\n", nil},
+		{"12\n.1\nph\n", errInvalidAnnotation}, // Kinds of some rows only
+		{"12\n.1\nph\nph\n", errInvalidAnnotation},
+		{"12\n.x\n", errInvalidAnnotation},
+		{"12\n1\n", errInvalidAnnotation},
+	}
+	for _, tc := range testCases {
+		fileName := path.Join(dir, "a.txt")
+		assert.Nil(t, ioutil.WriteFile(fileName, []byte(tc.content), 0644))
+		_, err := readAnnotation(fileName)
+		assert.Equal(t, tc.err, err, tc.content)
+	}
+}
+
+func TestWritingRecords(t *testing.T) {
+	records := []writingRecord{
+		{"s1.png", 0, 3, true, sudoku.WritingFeatures{StrokeVariation: 0.3, Height: 0.7, HeightDeviation: 0.2, Offset: 0.1}, 0.9},
+		{"s1.png", 0, 4, false, sudoku.WritingFeatures{StrokeVariation: 0.1, Height: 0.5, Offset: 0.02}, 1},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, writeWritingRecords(&buf, records))
+	read, err := readWritingRecords(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, records, read)
+
+	_, err = readWritingRecords(strings.NewReader(strings.Join(writingHeader, ",") + "\ns1.png,0,0,yes,0,0,0,0,0\n"))
+	assert.Equal(t, errInvalidRecord, err)
+
+	weights := fitLogistic(records, 1000, 4)
+	assert.True(t, writingProbability(weights, records[0]) > 0.5)
+	assert.True(t, writingProbability(weights, records[1]) < 0.5)
+}
+
+// Printed and handwritten digits of annotated example photos have to be told apart.
+// Weights of handwriting score are fitted on the same photos, it's a regression test.
+func TestHandwritingOnExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("recognises all example photos")
+	}
+
+	fileInfos, err := ioutil.ReadDir(exampleDir)
+	assert.Nil(t, err)
+
+	correct, total := 0, 0
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if path.Ext(name) != ".txt" {
+			continue
+		}
+		base := strings.TrimSuffix(name, ".txt")
+		a, err := readAnnotation(path.Join(exampleDir, name))
+		assert.Nil(t, err)
+		if a.Handwritten == nil {
+			continue
+		}
+
+		photo := base + ".png"
+		if _, err := os.Stat(path.Join(exampleDir, photo)); err != nil {
+			photo = base + ".jpg"
+		}
+		img, err := getExampleImage(photo)
+		assert.Nil(t, err)
+		s, err := sudoku.NewSudoku(img)
+		if !assert.Nil(t, err, photo) {
+			continue
+		}
+		recognised, err := s.Digits()
+		assert.Nil(t, err)
+
+		photoCorrect, photoTotal, printed, printedCorrect := 0, 0, 0, 0
+		for row := range a.Board {
+			for col, digit := range a.Board[row] {
+				cell := recognised[row][col]
+				if digit == 0 || cell.Kind == sudoku.CellEmpty {
+					continue
+				}
+				handwritten := cell.Kind == sudoku.CellHandwritten
+				if handwritten == a.Handwritten[row][col] {
+					photoCorrect++
+				}
+				if !a.Handwritten[row][col] {
+					printed++
+					if !handwritten {
+						printedCorrect++
+					}
+				}
+				photoTotal++
+			}
+		}
+		correct += photoCorrect
+		total += photoTotal
+		t.Logf("%v: %v of %v digits told apart, %v of %v printed", photo, photoCorrect, photoTotal, printedCorrect, printed)
+		assert.True(t, float64(photoCorrect) >= 0.85*float64(photoTotal), photo)
+		// Givens of the puzzle can't be taken for digits of the player
+		assert.True(t, float64(printedCorrect) >= 0.85*float64(printed), photo)
+	}
+
+	accuracy := float64(correct) / float64(total)
+	assert.True(t, total > 400)
+	assert.True(t, accuracy > 0.93, "accuracy %.3f", accuracy)
+}
@@ -0,0 +1,292 @@
+package sudoku
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Neighbours in clockwise order (y axis pointing down) starting from west
+var mooreNeighbours = [8]image.Point{
+	{-1, 0}, {-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1},
+}
+
+type component struct {
+	Label int
+	Start image.Point // Top-left most pixel, always on the contour
+	Size  int
+}
+
+type componentsBySize []component
+
+func (a componentsBySize) Len() int           { return len(a) }
+func (a componentsBySize) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a componentsBySize) Less(i, j int) bool { return a[i].Size > a[j].Size } // Reversed order most to least
+
+// Labels 8-connected components of non zero pixels.
+// Labels start from 1, 0 is used for background.
+func connectedComponents(src image.Gray) ([]int, []component) {
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	labels := make([]int, width*height, width*height)
+	var components []component
+
+	stack := make([]image.Point, 0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if src.Pix[src.PixOffset(x, y)] == 0 || labels[y*width+x] != 0 {
+				continue
+			}
+
+			comp := component{Label: len(components) + 1, Start: image.Point{x, y}}
+			labels[y*width+x] = comp.Label
+			stack = append(stack[:0], comp.Start)
+			for len(stack) > 0 {
+				pt := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				comp.Size++
+
+				for _, n := range mooreNeighbours {
+					nx, ny := pt.X+n.X, pt.Y+n.Y
+					if nx < 0 || nx >= width || ny < 0 || ny >= height {
+						continue
+					}
+					if src.Pix[src.PixOffset(nx, ny)] == 0 || labels[ny*width+nx] != 0 {
+						continue
+					}
+					labels[ny*width+nx] = comp.Label
+					stack = append(stack, image.Point{nx, ny})
+				}
+			}
+			components = append(components, comp)
+		}
+	}
+	return labels, components
+}
+
+// Moore neighbour tracing of outer contour of labeled component.
+// Stops when it's about to repeat the first step (Jacob's stopping criterion).
+func traceContour(labels []int, width, height int, comp component) []image.Point {
+	inside := func(pt image.Point) bool {
+		if pt.X < 0 || pt.X >= width || pt.Y < 0 || pt.Y >= height {
+			return false
+		}
+		return labels[pt.Y*width+pt.X] == comp.Label
+	}
+
+	// Finds next pixel clockwise, starting search after backtrack pixel
+	step := func(current image.Point, back int) (image.Point, int, bool) {
+		for j := 1; j <= 8; j++ {
+			next := current.Add(mooreNeighbours[(back+j)%8])
+			if inside(next) {
+				// Previously checked neighbour is outside, continue search from it
+				prev := current.Add(mooreNeighbours[(back+j-1)%8])
+				return next, neighbourIndex(prev.Sub(next)), true
+			}
+		}
+		return current, back, false
+	}
+
+	contour := []image.Point{comp.Start}
+	current, back := comp.Start, 0 // Start is top-left most, so west neighbour is outside
+
+	for i := 0; i < 4*comp.Size+8; i++ {
+		next, nextBack, ok := step(current, back)
+		if !ok {
+			break // Single pixel
+		}
+		if current == comp.Start && len(contour) > 1 && next == contour[1] {
+			break
+		}
+		current, back = next, nextBack
+		if current != comp.Start {
+			contour = append(contour, current)
+		}
+	}
+	return contour
+}
+
+func neighbourIndex(offset image.Point) int {
+	for i, n := range mooreNeighbours {
+		if n == offset {
+			return i
+		}
+	}
+	return 0
+}
+
+func crossProduct(o, a, b image.Point) int {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+// Andrew's monotone chain convex hull
+func convexHull(points []image.Point) []image.Point {
+	if len(points) < 3 {
+		return points
+	}
+
+	sorted := make([]image.Point, len(points), len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].X == sorted[j].X {
+			return sorted[i].Y < sorted[j].Y
+		}
+		return sorted[i].X < sorted[j].X
+	})
+
+	hull := make([]image.Point, 0, 2*len(sorted))
+	for _, pt := range sorted {
+		for len(hull) >= 2 && crossProduct(hull[len(hull)-2], hull[len(hull)-1], pt) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, pt)
+	}
+	lower := len(hull) + 1
+	for i := len(sorted) - 2; i >= 0; i-- {
+		pt := sorted[i]
+		for len(hull) >= lower && crossProduct(hull[len(hull)-2], hull[len(hull)-1], pt) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, pt)
+	}
+	return hull[:len(hull)-1]
+}
+
+func distanceToSegment(pt, a, b image.Point) float64 {
+	length := distanceBetweenPoints(a, b)
+	if length == 0 {
+		return distanceBetweenPoints(pt, a)
+	}
+	return math.Abs(float64(crossProduct(a, b, pt))) / length
+}
+
+// Ramer-Douglas-Peucker simplification of open polyline
+func simplifyPolyline(points []image.Point, epsilon float64) []image.Point {
+	if len(points) < 3 {
+		return append([]image.Point{}, points...)
+	}
+
+	first, last := points[0], points[len(points)-1]
+	index, maxDist := 0, 0.0
+	for i, pt := range points[1 : len(points)-1] {
+		if d := distanceToSegment(pt, first, last); d > maxDist {
+			index, maxDist = i+1, d
+		}
+	}
+
+	if maxDist <= epsilon {
+		return []image.Point{first, last}
+	}
+
+	left := simplifyPolyline(points[:index+1], epsilon)
+	right := simplifyPolyline(points[index:], epsilon)
+	return append(left[:len(left)-1], right...)
+}
+
+// Simplifies closed polygon by splitting it at two most distant points
+func approxPolygon(polygon []image.Point, epsilon float64) []image.Point {
+	if len(polygon) < 4 {
+		return polygon
+	}
+
+	farthest := func(from image.Point) int {
+		index, maxDist := 0, 0.0
+		for i, pt := range polygon {
+			if d := distanceBetweenPoints(from, pt); d > maxDist {
+				index, maxDist = i, d
+			}
+		}
+		return index
+	}
+
+	// Start from point far away from others, it's a good candidate for a corner
+	start := farthest(polygon[0])
+	polygon = append(append([]image.Point{}, polygon[start:]...), polygon[:start]...)
+	far := farthest(polygon[0])
+
+	closed := append(append([]image.Point{}, polygon[far:]...), polygon[0])
+	left := simplifyPolyline(polygon[:far+1], epsilon)
+	right := simplifyPolyline(closed, epsilon)
+	return append(left[:len(left)-1], right[:len(right)-1]...)
+}
+
+func polygonArea(polygon []image.Point) float64 {
+	area := 0
+	for i := range polygon {
+		j := (i + 1) % len(polygon)
+		area += polygon[i].X*polygon[j].Y - polygon[j].X*polygon[i].Y
+	}
+	return math.Abs(float64(area)) / 2
+}
+
+func perimeter(polygon []image.Point) float64 {
+	total := 0.0
+	for i := range polygon {
+		total += distanceBetweenPoints(polygon[i], polygon[(i+1)%len(polygon)])
+	}
+	return total
+}
+
+// Orders corners: top-left, top-right, bottom-right, bottom-left
+func orderCorners(quad []image.Point) [4]pointF {
+	var cx, cy float64
+	for _, pt := range quad {
+		cx += float64(pt.X) / 4
+		cy += float64(pt.Y) / 4
+	}
+
+	sorted := make([]image.Point, 4, 4)
+	copy(sorted, quad)
+	sort.Slice(sorted, func(i, j int) bool {
+		return math.Atan2(float64(sorted[i].Y)-cy, float64(sorted[i].X)-cx) <
+			math.Atan2(float64(sorted[j].Y)-cy, float64(sorted[j].X)-cx)
+	})
+
+	first := 0
+	for i, pt := range sorted {
+		if pt.X+pt.Y < sorted[first].X+sorted[first].Y {
+			first = i
+		}
+	}
+
+	var corners [4]pointF
+	for i := range corners {
+		corners[i] = newPointF(sorted[(first+i)%4])
+	}
+	return corners
+}
+
+// Finds the biggest convex quadrilateral formed by outer contour of connected components.
+// Only quadrilaterals covering at least minArea (fraction of the image) are considered.
+func largestQuadrilateral(src image.Gray, minArea float64) ([4]pointF, bool) {
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	labels, components := connectedComponents(src)
+	sort.Sort(componentsBySize(components))
+
+	bestArea := minArea * float64(width*height)
+	var best [4]pointF
+	found := false
+
+	for _, comp := range components[:minInt(10, len(components))] {
+		hull := convexHull(traceContour(labels, width, height, comp))
+		if len(hull) < 4 {
+			continue
+		}
+
+		hullPerimeter := perimeter(hull)
+		for _, ratio := range []float64{0.01, 0.02, 0.04, 0.08} {
+			quad := approxPolygon(hull, ratio*hullPerimeter)
+			if len(quad) > 4 {
+				continue
+			}
+			if len(quad) == 4 {
+				if area := polygonArea(quad); area > bestArea {
+					bestArea = area
+					best = orderCorners(quad)
+					found = true
+				}
+			}
+			break
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,99 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func grayFromRows(rows []string) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				img.Pix[img.PixOffset(x, y)] = 255
+			}
+		}
+	}
+	return img
+}
+
+func TestConnectedComponents(t *testing.T) {
+	img := grayFromRows([]string{
+		"##...",
+		"#...#",
+		"...#.",
+		"#....",
+	})
+
+	labels, components := connectedComponents(*img)
+	assert.Len(t, components, 3)
+	assert.EqualValues(t, []component{
+		{Label: 1, Start: image.Point{0, 0}, Size: 3},
+		{Label: 2, Start: image.Point{4, 1}, Size: 2},
+		{Label: 3, Start: image.Point{0, 3}, Size: 1},
+	}, components)
+	assert.Equal(t, 2, labels[2*5+3])
+	assert.Equal(t, 0, labels[2*5+2])
+}
+
+func TestTraceContour(t *testing.T) {
+	img := grayFromRows([]string{
+		"......",
+		".####.",
+		".####.",
+		".####.",
+		"......",
+	})
+
+	labels, components := connectedComponents(*img)
+	contour := traceContour(labels, 6, 5, components[0])
+	assert.EqualValues(t, []image.Point{
+		{1, 1}, {2, 1}, {3, 1}, {4, 1},
+		{4, 2}, {4, 3},
+		{3, 3}, {2, 3}, {1, 3},
+		{1, 2},
+	}, contour)
+
+	single := grayFromRows([]string{"#"})
+	labels, components = connectedComponents(*single)
+	assert.EqualValues(t, []image.Point{{0, 0}}, traceContour(labels, 1, 1, components[0]))
+}
+
+func TestConvexHull(t *testing.T) {
+	points := []image.Point{{0, 0}, {2, 1}, {4, 0}, {3, 2}, {4, 4}, {2, 3}, {0, 4}, {1, 2}}
+	hull := convexHull(points)
+	assert.EqualValues(t, []image.Point{{0, 0}, {4, 0}, {4, 4}, {0, 4}}, hull)
+}
+
+func TestApproxPolygon(t *testing.T) {
+	polygon := []image.Point{{0, 0}, {5, 1}, {10, 0}, {10, 10}, {5, 9}, {0, 10}}
+	assert.Len(t, approxPolygon(polygon, 0.5), 6)
+	assert.EqualValues(t, []image.Point{{10, 10}, {0, 10}, {0, 0}, {10, 0}}, approxPolygon(polygon, 2))
+}
+
+func TestLargestQuadrilateral(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 200))
+
+	corners := []image.Point{{40, 30}, {170, 45}, {160, 175}, {25, 160}}
+	for i := range corners {
+		fragment := lineFragment{corners[i], corners[(i+1)%4]}
+		for _, pt := range pointsOnLineFragment(fragment) {
+			img.Pix[img.PixOffset(pt.X, pt.Y)] = 255
+			img.Pix[img.PixOffset(pt.X+1, pt.Y)] = 255
+		}
+	}
+	// Noise that should be ignored
+	img.Pix[img.PixOffset(5, 5)] = 255
+
+	quad, ok := largestQuadrilateral(*img, 0.1)
+	assert.True(t, ok)
+	for i, corner := range corners {
+		assert.InDelta(t, corner.X, quad[i].X, 2)
+		assert.InDelta(t, corner.Y, quad[i].Y, 2)
+	}
+
+	_, ok = largestQuadrilateral(*img, 0.9)
+	assert.False(t, ok)
+}
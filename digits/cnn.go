@@ -0,0 +1,440 @@
+package digits
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/mrfuxi/neural"
+)
+
+// CNNConfig describes small convolutional network:
+// convolution (valid, stride 1) with ReLU, max pooling, dense hidden layer with ReLU
+// and dense output layer with softmax.
+type CNNConfig struct {
+	Filters    int `json:"filters"`    // Number of convolution kernels
+	KernelSize int `json:"kernelSize"` // Kernels are KernelSize x KernelSize
+	PoolSize   int `json:"poolSize"`   // Max pooling of PoolSize x PoolSize blocks
+	Hidden     int `json:"hidden"`     // Size of dense hidden layer
+}
+
+// DefaultCNNConfig works well with 28x28 cells
+var DefaultCNNConfig = CNNConfig{
+	Filters:    8,
+	KernelSize: 5,
+	PoolSize:   2,
+	Hidden:     64,
+}
+
+// Layer of CNN. Apply only computes output and can run concurrently,
+// forward also remembers what's needed by backward pass.
+// Backward accumulates gradients of parameters and returns gradient of input.
+type cnnLayer interface {
+	apply(input []float64) []float64
+	forward(input []float64) []float64
+	backward(gradOutput []float64) []float64
+	params() [][]float64 // Weights and biases
+	grads() [][]float64  // Accumulated gradients, same shapes as params
+}
+
+type convLayer struct {
+	inA, inB, inC    int // Input dimensions: image is inA x inB, with inC channels
+	outA, outB, outC int
+	k                int
+	weights, bias    []float64
+	gradW, gradB     []float64
+	input            []float64
+}
+
+func newConvLayer(inA, inB, inC, filters, k int) *convLayer {
+	size := filters * inC * k * k
+	return &convLayer{
+		inA: inA, inB: inB, inC: inC,
+		outA: inA - k + 1, outB: inB - k + 1, outC: filters,
+		k:       k,
+		weights: make([]float64, size, size),
+		bias:    make([]float64, filters, filters),
+		gradW:   make([]float64, size, size),
+		gradB:   make([]float64, filters, filters),
+	}
+}
+
+func (l *convLayer) weightIndex(f, c, i, j int) int {
+	return ((f*l.inC+c)*l.k+i)*l.k + j
+}
+
+func (l *convLayer) forward(input []float64) []float64 {
+	l.input = input
+	return l.apply(input)
+}
+
+func (l *convLayer) apply(input []float64) []float64 {
+	output := make([]float64, l.outC*l.outA*l.outB)
+	for f := 0; f < l.outC; f++ {
+		for a := 0; a < l.outA; a++ {
+			for b := 0; b < l.outB; b++ {
+				sum := l.bias[f]
+				for c := 0; c < l.inC; c++ {
+					for i := 0; i < l.k; i++ {
+						row := (c*l.inA+a+i)*l.inB + b
+						w := l.weightIndex(f, c, i, 0)
+						for j := 0; j < l.k; j++ {
+							sum += l.weights[w+j] * input[row+j]
+						}
+					}
+				}
+				output[(f*l.outA+a)*l.outB+b] = sum
+			}
+		}
+	}
+	return output
+}
+
+func (l *convLayer) backward(gradOutput []float64) []float64 {
+	gradInput := make([]float64, len(l.input))
+	for f := 0; f < l.outC; f++ {
+		for a := 0; a < l.outA; a++ {
+			for b := 0; b < l.outB; b++ {
+				g := gradOutput[(f*l.outA+a)*l.outB+b]
+				if g == 0 {
+					continue
+				}
+				l.gradB[f] += g
+				for c := 0; c < l.inC; c++ {
+					for i := 0; i < l.k; i++ {
+						row := (c*l.inA+a+i)*l.inB + b
+						w := l.weightIndex(f, c, i, 0)
+						for j := 0; j < l.k; j++ {
+							l.gradW[w+j] += g * l.input[row+j]
+							gradInput[row+j] += g * l.weights[w+j]
+						}
+					}
+				}
+			}
+		}
+	}
+	return gradInput
+}
+
+func (l *convLayer) params() [][]float64 { return [][]float64{l.weights, l.bias} }
+func (l *convLayer) grads() [][]float64  { return [][]float64{l.gradW, l.gradB} }
+
+type reluLayer struct {
+	output []float64
+}
+
+func (l *reluLayer) forward(input []float64) []float64 {
+	l.output = l.apply(input)
+	return l.output
+}
+
+func (l *reluLayer) apply(input []float64) []float64 {
+	output := make([]float64, len(input))
+	for i, v := range input {
+		output[i] = math.Max(0, v)
+	}
+	return output
+}
+
+func (l *reluLayer) backward(gradOutput []float64) []float64 {
+	gradInput := make([]float64, len(gradOutput))
+	for i, g := range gradOutput {
+		if l.output[i] > 0 {
+			gradInput[i] = g
+		}
+	}
+	return gradInput
+}
+
+func (l *reluLayer) params() [][]float64 { return nil }
+func (l *reluLayer) grads() [][]float64  { return nil }
+
+type poolLayer struct {
+	inA, inB, channels int
+	outA, outB         int
+	size               int
+	argmax             []int // Input index of maximum for every output
+	inputSize          int
+}
+
+func newPoolLayer(inA, inB, channels, size int) *poolLayer {
+	return &poolLayer{
+		inA: inA, inB: inB, channels: channels,
+		outA: inA / size, outB: inB / size,
+		size: size,
+	}
+}
+
+func (l *poolLayer) forward(input []float64) []float64 {
+	l.inputSize = len(input)
+	var output []float64
+	output, l.argmax = l.pool(input)
+	return output
+}
+
+func (l *poolLayer) apply(input []float64) []float64 {
+	output, _ := l.pool(input)
+	return output
+}
+
+// Returns maximum of every block and its index in the input
+func (l *poolLayer) pool(input []float64) ([]float64, []int) {
+	output := make([]float64, l.channels*l.outA*l.outB)
+	argmax := make([]int, len(output))
+	for c := 0; c < l.channels; c++ {
+		for a := 0; a < l.outA; a++ {
+			for b := 0; b < l.outB; b++ {
+				best := -1
+				for i := 0; i < l.size; i++ {
+					for j := 0; j < l.size; j++ {
+						idx := (c*l.inA+a*l.size+i)*l.inB + b*l.size + j
+						if best < 0 || input[idx] > input[best] {
+							best = idx
+						}
+					}
+				}
+				out := (c*l.outA+a)*l.outB + b
+				output[out] = input[best]
+				argmax[out] = best
+			}
+		}
+	}
+	return output, argmax
+}
+
+func (l *poolLayer) backward(gradOutput []float64) []float64 {
+	gradInput := make([]float64, l.inputSize)
+	for out, idx := range l.argmax {
+		gradInput[idx] += gradOutput[out]
+	}
+	return gradInput
+}
+
+func (l *poolLayer) params() [][]float64 { return nil }
+func (l *poolLayer) grads() [][]float64  { return nil }
+
+type denseLayer struct {
+	in, out       int
+	weights, bias []float64
+	gradW, gradB  []float64
+	input         []float64
+}
+
+func newDenseLayer(in, out int) *denseLayer {
+	return &denseLayer{
+		in: in, out: out,
+		weights: make([]float64, in*out, in*out),
+		bias:    make([]float64, out, out),
+		gradW:   make([]float64, in*out, in*out),
+		gradB:   make([]float64, out, out),
+	}
+}
+
+func (l *denseLayer) forward(input []float64) []float64 {
+	l.input = input
+	return l.apply(input)
+}
+
+func (l *denseLayer) apply(input []float64) []float64 {
+	output := make([]float64, l.out)
+	for o := 0; o < l.out; o++ {
+		sum := l.bias[o]
+		row := l.weights[o*l.in : (o+1)*l.in]
+		for i, x := range input {
+			sum += row[i] * x
+		}
+		output[o] = sum
+	}
+	return output
+}
+
+func (l *denseLayer) backward(gradOutput []float64) []float64 {
+	gradInput := make([]float64, l.in)
+	for o, g := range gradOutput {
+		if g == 0 {
+			continue
+		}
+		l.gradB[o] += g
+		row := l.weights[o*l.in : (o+1)*l.in]
+		gradRow := l.gradW[o*l.in : (o+1)*l.in]
+		for i, x := range l.input {
+			gradRow[i] += g * x
+			gradInput[i] += g * row[i]
+		}
+	}
+	return gradInput
+}
+
+func (l *denseLayer) params() [][]float64 { return [][]float64{l.weights, l.bias} }
+func (l *denseLayer) grads() [][]float64  { return [][]float64{l.gradW, l.gradB} }
+
+// CNN is convolutional network recognising digits, implemented in pure Go
+type CNN struct {
+	config CNNConfig
+	layers []cnnLayer
+}
+
+// NewCNN creates network for width x height input and given number of classes.
+// Weights are initialised randomly from seed.
+func NewCNN(config CNNConfig, width, height, classes int, seed int64) *CNN {
+	// Input is column by column, so first dimension is x
+	conv := newConvLayer(width, height, 1, config.Filters, config.KernelSize)
+	pool := newPoolLayer(conv.outA, conv.outB, conv.outC, config.PoolSize)
+	hidden := newDenseLayer(pool.channels*pool.outA*pool.outB, config.Hidden)
+	output := newDenseLayer(config.Hidden, classes)
+
+	c := &CNN{
+		config: config,
+		layers: []cnnLayer{conv, &reluLayer{}, pool, hidden, &reluLayer{}, output},
+	}
+
+	// He initialisation, biases start from 0
+	rnd := rand.New(rand.NewSource(seed))
+	fanIns := []int{config.KernelSize * config.KernelSize, hidden.in, output.in}
+	for i, layer := range []cnnLayer{conv, hidden, output} {
+		weights := layer.params()[0]
+		scale := math.Sqrt(2 / float64(fanIns[i]))
+		for j := range weights {
+			weights[j] = rnd.NormFloat64() * scale
+		}
+	}
+	return c
+}
+
+func softmax(values []float64) []float64 {
+	max := math.Inf(-1)
+	for _, v := range values {
+		max = math.Max(max, v)
+	}
+
+	sum := 0.0
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = math.Exp(v - max)
+		sum += result[i]
+	}
+	for i := range result {
+		result[i] /= sum
+	}
+	return result
+}
+
+// Evaluate returns probabilities of every class, input goes column by column.
+// Network is not modified, so it's safe to evaluate concurrently.
+func (c *CNN) Evaluate(input []float64) []float64 {
+	values := input
+	for _, layer := range c.layers {
+		values = layer.apply(values)
+	}
+	return softmax(values)
+}
+
+// EvaluateBatch returns probabilities of every class for all inputs.
+// Inputs are split between all CPUs and evaluated at the same time.
+func (c *CNN) EvaluateBatch(inputs [][]float64) [][]float64 {
+	outputs := make([][]float64, len(inputs), len(inputs))
+	workers := minInt(runtime.NumCPU(), len(inputs))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			for i := w; i < len(inputs); i += workers {
+				outputs[i] = c.Evaluate(inputs[i])
+			}
+			wg.Done()
+		}(w)
+	}
+	wg.Wait()
+	return outputs
+}
+
+// Evaluates input remembering state of every layer for backward pass
+func (c *CNN) forward(input []float64) []float64 {
+	values := input
+	for _, layer := range c.layers {
+		values = layer.forward(values)
+	}
+	return softmax(values)
+}
+
+// Runs forward and backward pass, gradients are accumulated.
+// Returns cross entropy loss.
+func (c *CNN) backprop(example neural.TrainExample) float64 {
+	probabilities := c.forward(example.Input)
+
+	// Gradient of cross entropy with softmax
+	loss := 0.0
+	grad := make([]float64, len(probabilities))
+	for i, p := range probabilities {
+		grad[i] = p - example.Output[i]
+		if example.Output[i] > 0 {
+			loss -= example.Output[i] * math.Log(math.Max(p, 1e-300))
+		}
+	}
+
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		grad = c.layers[i].backward(grad)
+	}
+	return loss
+}
+
+// Applies accumulated gradients and resets them
+func (c *CNN) update(learningRate float64, batchSize int) {
+	step := learningRate / float64(batchSize)
+	for _, layer := range c.layers {
+		grads := layer.grads()
+		for i, params := range layer.params() {
+			for j := range params {
+				params[j] -= step * grads[i][j]
+				grads[i][j] = 0
+			}
+		}
+	}
+}
+
+// TrainEpoch runs one epoch of mini batch gradient descent on shuffled examples.
+// Returns mean cross entropy loss.
+func (c *CNN) TrainEpoch(examples []neural.TrainExample, learningRate float64, batchSize int, rnd *rand.Rand) float64 {
+	if len(examples) == 0 {
+		return 0
+	}
+
+	loss := 0.0
+	order := rnd.Perm(len(examples))
+	for start := 0; start < len(order); start += batchSize {
+		end := minInt(start+batchSize, len(order))
+		for _, idx := range order[start:end] {
+			loss += c.backprop(examples[idx])
+		}
+		c.update(learningRate, end-start)
+	}
+	return loss / float64(len(examples))
+}
+
+// Save writes all weights and biases, architecture is stored in the manifest
+func (c *CNN) Save(w io.Writer) error {
+	for _, layer := range c.layers {
+		for _, params := range layer.params() {
+			if err := binary.Write(w, binary.LittleEndian, params); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Load reads weights and biases written by Save into network of the same architecture
+func (c *CNN) Load(r io.Reader) error {
+	for _, layer := range c.layers {
+		for _, params := range layer.params() {
+			if err := binary.Read(r, binary.LittleEndian, params); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
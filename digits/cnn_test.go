@@ -0,0 +1,161 @@
+package digits
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/mrfuxi/neural"
+	"github.com/stretchr/testify/assert"
+)
+
+var smallCNN = CNNConfig{Filters: 2, KernelSize: 3, PoolSize: 2, Hidden: 5}
+
+// 8x8 images with vertical (class 0) or horizontal (class 1) line
+func lineExamples() []neural.TrainExample {
+	var examples []neural.TrainExample
+	for pos := 1; pos < 7; pos++ {
+		vertical := make([]float64, 64, 64)
+		horizontal := make([]float64, 64, 64)
+		for i := 1; i < 7; i++ {
+			// Input goes column by column: index is x*height+y
+			vertical[pos*8+i] = 1
+			horizontal[i*8+pos] = 1
+		}
+		examples = append(examples,
+			neural.TrainExample{Input: vertical, Output: []float64{1, 0}},
+			neural.TrainExample{Input: horizontal, Output: []float64{0, 1}},
+		)
+	}
+	return examples
+}
+
+func TestCNNEvaluate(t *testing.T) {
+	cnn := NewCNN(DefaultCNNConfig, 28, 28, 10, 1)
+	output := cnn.Evaluate(make([]float64, InputSize, InputSize))
+
+	assert.Len(t, output, 10)
+	sum := 0.0
+	for _, p := range output {
+		sum += p
+	}
+	assert.InDelta(t, 1, sum, 0.0001)
+}
+
+func TestCNNEvaluateBatch(t *testing.T) {
+	cnn := NewCNN(smallCNN, 8, 8, 2, 1)
+	examples := lineExamples()
+	inputs := make([][]float64, len(examples), len(examples))
+	for i, example := range examples {
+		inputs[i] = example.Input
+	}
+
+	outputs := cnn.EvaluateBatch(inputs)
+	assert.Len(t, outputs, len(inputs))
+	for i, input := range inputs {
+		assert.Equal(t, cnn.Evaluate(input), outputs[i])
+	}
+	assert.Len(t, cnn.EvaluateBatch(nil), 0)
+}
+
+func TestCNNGradient(t *testing.T) {
+	cnn := NewCNN(smallCNN, 8, 8, 2, 3)
+	example := lineExamples()[3]
+	// Biases start from 0, so empty areas would sit exactly at the ReLU kink
+	for _, layer := range cnn.layers {
+		if params := layer.params(); params != nil {
+			for j := range params[1] {
+				params[1][j] = 0.1
+			}
+		}
+	}
+	cnn.backprop(example)
+
+	loss := func() float64 {
+		p := cnn.Evaluate(example.Input)
+		return -math.Log(p[1])
+	}
+
+	// Compare with numerical gradient of few parameters in every layer
+	epsilon := 1e-5
+	for _, layer := range cnn.layers {
+		for i, params := range layer.params() {
+			grads := layer.grads()[i]
+			for _, j := range []int{0, len(params) / 2, len(params) - 1} {
+				original := params[j]
+				params[j] = original + epsilon
+				plus := loss()
+				params[j] = original - epsilon
+				minus := loss()
+				params[j] = original
+
+				numerical := (plus - minus) / (2 * epsilon)
+				assert.InDelta(t, numerical, grads[j], 1e-4, "Parameter %v", j)
+			}
+		}
+	}
+}
+
+func TestCNNTrain(t *testing.T) {
+	cnn := NewCNN(smallCNN, 8, 8, 2, 1)
+	examples := lineExamples()
+	rnd := rand.New(rand.NewSource(1))
+
+	first := cnn.TrainEpoch(examples, 0.1, 4, rnd)
+	var last float64
+	for epoch := 0; epoch < 50; epoch++ {
+		last = cnn.TrainEpoch(examples, 0.1, 4, rnd)
+	}
+	assert.True(t, last < first/2, "Loss %v -> %v", first, last)
+
+	for _, example := range examples {
+		class, _ := Probabilities(cnn.Evaluate(example.Input)).Best()
+		expected, _ := Probabilities(example.Output).Best()
+		assert.Equal(t, expected, class)
+	}
+}
+
+func TestCNNSaveLoad(t *testing.T) {
+	cnn := NewCNN(smallCNN, 8, 8, 2, 1)
+	input := lineExamples()[0].Input
+
+	var buf bytes.Buffer
+	assert.Nil(t, cnn.Save(&buf))
+
+	loaded := NewCNN(smallCNN, 8, 8, 2, 2) // Different weights before loading
+	assert.NotEqual(t, cnn.Evaluate(input), loaded.Evaluate(input))
+	assert.Nil(t, loaded.Load(&buf))
+	assert.Equal(t, cnn.Evaluate(input), loaded.Evaluate(input))
+
+	assert.NotNil(t, loaded.Load(&buf)) // Nothing more to read
+}
+
+func TestReadCNN(t *testing.T) {
+	m := DefaultManifest
+	m.Kind = KindCNN
+	m.Layers, m.Activators = nil, nil
+	m.CNN = &smallCNN
+	m.InputWidth, m.InputHeight = 8, 8
+	m.Labels = []string{"|", "-"}
+
+	cnn, err := NewCNNFromManifest(m)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, SaveNetwork(&buf, cnn, m))
+
+	loaded, manifest, err := ReadNetwork(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, m, manifest)
+	input := lineExamples()[0].Input
+	assert.Equal(t, cnn.Evaluate(input), loaded.Evaluate(input))
+
+	_, err = NewNetworkFromManifest(m)
+	assert.NotNil(t, err)
+	_, err = NewCNNFromManifest(DefaultManifest)
+	assert.NotNil(t, err)
+
+	m.InputWidth = 3 // Too small for 3x3 kernel and pooling
+	assert.NotNil(t, m.Validate())
+}
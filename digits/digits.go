@@ -1,35 +1,35 @@
 package digits
 
 import (
+	"errors"
 	"image"
 	"image/color"
-	"log"
-	"os"
-
-	"github.com/mrfuxi/neural"
+	"math"
+	"sync"
 )
 
-var nn neural.Evaluator
+var nn Recogniser
+var nnLock sync.Mutex // Network keeps state while evaluating
+var manifest = DefaultManifest
 
-// LoadNetwork intializes global neural network used to process digits
-func LoadNetwork(fileName string) {
-	inputSize := 28 * 28
+// ErrEmptyImage is reported when there are no pixels to recognise
+var ErrEmptyImage = errors.New("Image is empty")
 
-	activator := neural.NewSigmoidActivator()
-	outActivator := neural.NewSoftmaxActivator()
-	nn = neural.NewNeuralNetwork(
-		[]int{inputSize, 100, 10},
-		neural.NewFullyConnectedLayer(activator),
-		neural.NewFullyConnectedLayer(outActivator),
-	)
+// ErrNoNetwork is reported when LoadNetwork was not called and there is no embedded network
+var ErrNoNetwork = errors.New("Neural network is not loaded")
 
-	fn, err := os.Open(fileName)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if err := neural.Load(nn, fn); err != nil {
-		log.Fatal(err)
-	}
+// ErrInvalidSize is reported when batch contains image of size other than input of the network
+var ErrInvalidSize = errors.New("Image size does not match input of the network")
+
+// InputSize is number of pixels of MNIST image given to the default network
+const InputSize = 28 * 28
+
+// Probabilities of every class for one cell, indexed like labels of the model (digits 0-9 by default)
+type Probabilities []float64
+
+// Best returns index of the most probable class and its probability
+func (p Probabilities) Best() (int, float64) {
+	return argmax(p)
 }
 
 func argmax(A []float64) (int, float64) {
@@ -44,29 +44,270 @@ func argmax(A []float64) (int, float64) {
 	return x, v
 }
 
-// RecogniseDigit takes 28x28 gray image and tries to recognise a digit
-// panics if image has wrong size
+// Recognition is the result of recognising a digit in one cell
+type Recognition struct {
+	Digit      int // -1 when the most probable class is not a digit, e.g. blank cell
+	Confidence float64
+	// Probabilities of every class, indexed like labels of the model
+	Probabilities Probabilities
+	// DigitProbabilities are indexed by digit, classes which are not digits are left out
+	DigitProbabilities Probabilities
+	// Input is image given to the network (28x28 by default), useful for debugging.
+	// It's set only by RecogniseCell.
+	Input *image.Gray
+}
+
+// Scales image to width x height with bilinear interpolation
+func resize(img image.Gray, width, height int) image.Gray {
+	bounds := img.Bounds()
+	if bounds == image.Rect(0, 0, width, height) {
+		return img
+	}
+
+	dst := *image.NewGray(image.Rect(0, 0, width, height))
+	scaleX := float64(bounds.Dx()) / float64(width)
+	scaleY := float64(bounds.Dy()) / float64(height)
+	at := func(x, y int) float64 {
+		x = minInt(maxInt(x, 0), bounds.Dx()-1)
+		y = minInt(maxInt(y, 0), bounds.Dy()-1)
+		return float64(img.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Centres of pixels are aligned
+			srcX := (float64(x)+0.5)*scaleX - 0.5
+			srcY := (float64(y)+0.5)*scaleY - 0.5
+			x0, y0 := int(math.Floor(srcX)), int(math.Floor(srcY))
+			fx, fy := srcX-float64(x0), srcY-float64(y0)
+
+			top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+			bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+			dst.Pix[dst.PixOffset(x, y)] = uint8(top*(1-fy) + bottom*fy + 0.5)
+		}
+	}
+	return dst
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// RecogniseCell tries to recognise a digit in a cell of any size.
+// Cell is resized to input of the network, pixels darker than threshold are treated as ink.
+// Given image is not modified.
+func RecogniseCell(img image.Gray, threshold uint8) (Recognition, error) {
+	if img.Bounds().Empty() {
+		return Recognition{}, ErrEmptyImage
+	}
+	network, m, err := currentNetwork()
+	if err != nil {
+		return Recognition{}, err
+	}
+
+	width, height := m.InputWidth, m.InputHeight
+	input := make([]float64, width*height, width*height)
+	inputVector(resize(img, width, height), threshold, input)
+
+	nnLock.Lock()
+	recognition := m.recognition(network.Evaluate(input))
+	nnLock.Unlock()
+
+	debug := image.NewGray(image.Rect(0, 0, width, height))
+	pos := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			debug.SetGray(x, y, color.Gray{Y: uint8(input[pos]*255 + 0.5)})
+			pos++
+		}
+	}
+
+	recognition.Input = debug
+	return recognition, nil
+}
+
+// RecogniseDigit takes gray image and tries to recognise a digit.
+// Returns 0 with no confidence when image can't be processed, use RecogniseCell to get the error.
 func RecogniseDigit(img image.Gray, threshold uint8) (int, float64) {
-	if img.Bounds().Max.X != 28 || img.Bounds().Max.Y != 28 {
-		panic("Image size is invalid, use 28x28.")
+	recognition, err := RecogniseCell(img, threshold)
+	if err != nil {
+		return 0, 0
 	}
+	return recognition.Digit, recognition.Confidence
+}
 
-	input := make([]float64, 28*28, 28*28)
+// Otsu's threshold of the image
+func otsuThreshold(img image.Gray) uint8 {
+	var histogram [256]float64
+	for _, pix := range img.Pix {
+		histogram[pix]++
+	}
+
+	total := float64(len(img.Pix))
+	sum := 0.0
+	for i, count := range histogram {
+		sum += float64(i) * count
+	}
+
+	var sumB, wB, best float64
+	first, last := 0, 0 // Every threshold between them is equally good
+	for i, count := range histogram {
+		wB += count
+		wF := total - wB
+		if wB == 0 {
+			continue
+		}
+		if wF == 0 {
+			break
+		}
+		sumB += float64(i) * count
+		mB, mF := sumB/wB, (sum-sumB)/wF
+		between := wB * wF * (mB - mF) * (mB - mF)
+		if between > best {
+			best, first, last = between, i, i
+		} else if between == best {
+			last = i
+		}
+	}
+	return uint8((first + last) / 2)
+}
+
+// Input of the network: dark pixels (below threshold) become bright and normalised to 0-1.
+// Pixels go column by column, same as in the training data.
+// Image is not modified.
+func inputVector(img image.Gray, threshold uint8, input []float64) {
+	bounds := img.Bounds()
 	pos := 0
-	for x := 0; x < 28; x++ {
-		for y := 0; y < 28; y++ {
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			val := img.GrayAt(x, y).Y
 			if val < threshold {
-				val = 255 - val
+				input[pos] = float64(255-val) / 255
 			} else {
-				val = 0
+				input[pos] = 0
 			}
+			pos++
+		}
+	}
+}
 
-			img.SetGray(x, y, color.Gray{Y: val})
-			input[pos] = float64(val) / 255
+// Evaluates all inputs, in one batch when network supports it
+func evaluateAll(network Recogniser, inputs [][]float64) [][]float64 {
+	if batch, ok := network.(BatchRecogniser); ok {
+		return batch.EvaluateBatch(inputs)
+	}
+
+	// Networks of neural package keep state while evaluating
+	nnLock.Lock()
+	defer nnLock.Unlock()
+	outputs := make([][]float64, len(inputs), len(inputs))
+	for i, input := range inputs {
+		outputs[i] = append([]float64{}, network.Evaluate(input)...)
+	}
+	return outputs
+}
+
+// RecogniseBatch recognises digits on all cells [row][col],
+// cells have to match input of the network (28x28 by default).
+// Every cell is thresholded on its own, cells are not modified.
+// Inputs are prepared in parallel and evaluated in one batch by networks which
+// support it (CNN), other networks evaluate them cell by cell.
+// Returns recognition of every cell, digits are mapped through labels of the model.
+func RecogniseBatch(cells [][]image.Gray) ([][]Recognition, error) {
+	network, m, err := currentNetwork()
+	if err != nil {
+		return nil, err
+	}
+
+	inputSize := m.InputWidth * m.InputHeight
+	count := 0
+	for _, row := range cells {
+		for _, cell := range row {
+			if cell.Bounds().Dx() != m.InputWidth || cell.Bounds().Dy() != m.InputHeight {
+				return nil, ErrInvalidSize
+			}
+			count++
+		}
+	}
+
+	// One input matrix, row per cell
+	matrix := make([]float64, count*inputSize, count*inputSize)
+	inputs := make([][]float64, count, count)
+	var wg sync.WaitGroup
+	pos := 0
+	for _, row := range cells {
+		for _, cell := range row {
+			inputs[pos] = matrix[pos*inputSize : (pos+1)*inputSize]
+			wg.Add(1)
+			go func(cell image.Gray, input []float64) {
+				inputVector(cell, otsuThreshold(cell), input)
+				wg.Done()
+			}(cell, inputs[pos])
+			pos++
+		}
+	}
+	wg.Wait()
+
+	outputs := evaluateAll(network, inputs)
+	result := make([][]Recognition, len(cells), len(cells))
+	pos = 0
+	for r, row := range cells {
+		result[r] = make([]Recognition, len(row), len(row))
+		for c := range row {
+			result[r][c] = m.recognition(outputs[pos])
 			pos++
 		}
 	}
-	digit, confidence := argmax(nn.Evaluate(input))
-	return digit, confidence
+	return result, nil
+}
+
+// Input prepares cell of any size as input of the current network, the same way
+// cells are prepared for recognition
+func Input(img image.Gray) ([]float64, error) {
+	if img.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+	_, m, err := currentNetwork()
+	if err != nil {
+		return nil, err
+	}
+	return m.Input(img)
+}
+
+// Input prepares cell of any size as input of network described by the manifest.
+// Useful to build training data.
+func (m Manifest) Input(img image.Gray) ([]float64, error) {
+	if img.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+
+	width, height := m.InputWidth, m.InputHeight
+	resized := resize(img, width, height)
+	input := make([]float64, width*height, width*height)
+	inputVector(resized, otsuThreshold(resized), input)
+	return input, nil
+}
+
+// InputFromMNIST converts 28x28 MNIST image (row by row, bright digit on black)
+// into input of the network. Image is thresholded like cells during recognition,
+// so the network is trained on the same kind of input it sees later.
+func InputFromMNIST(pixels []uint8) []float64 {
+	img := *image.NewGray(image.Rect(0, 0, 28, 28))
+	for i, pix := range pixels[:InputSize] {
+		img.Pix[i] = 255 - pix // Dark digit on white, like cells
+	}
+
+	input := make([]float64, InputSize, InputSize)
+	inputVector(img, otsuThreshold(img), input)
+	return input
 }
@@ -0,0 +1,171 @@
+package digits
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 28x28 white image with dark vertical stroke
+func drawOne() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 28, 28))
+	for i := range img.Pix {
+		img.Pix[i] = 230
+	}
+	for y := 4; y < 24; y++ {
+		img.Pix[img.PixOffset(13, y)] = 20
+		img.Pix[img.PixOffset(14, y)] = 20
+	}
+	return img
+}
+
+func TestProbabilitiesBest(t *testing.T) {
+	digit, probability := Probabilities{0.1, 0.05, 0.7, 0.15}.Best()
+	assert.Equal(t, 2, digit)
+	assert.Equal(t, 0.7, probability)
+}
+
+func TestOtsuThreshold(t *testing.T) {
+	threshold := otsuThreshold(*drawOne())
+	assert.Equal(t, uint8(124), threshold) // Middle between two colours
+}
+
+func TestInputVector(t *testing.T) {
+	img := drawOne()
+	original := append([]uint8{}, img.Pix...)
+
+	input := make([]float64, InputSize, InputSize)
+	inputVector(*img, 128, input)
+
+	assert.Equal(t, original, img.Pix) // Not modified
+	assert.Equal(t, 0.0, input[0])
+	assert.InDelta(t, 235.0/255, input[13*28+4], 0.0001) // Column by column
+	assert.Equal(t, 0.0, input[4*28+13])
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 56, 56))
+	for y := 0; y < 56; y++ {
+		for x := 28; x < 56; x++ {
+			img.Pix[img.PixOffset(x, y)] = 200
+		}
+	}
+
+	resized := resize(*img, 28, 28)
+	assert.Equal(t, image.Rect(0, 0, 28, 28), resized.Bounds())
+	assert.Equal(t, uint8(0), resized.GrayAt(5, 5).Y)
+	assert.Equal(t, uint8(200), resized.GrayAt(20, 5).Y)
+	assert.Equal(t, uint8(0), resized.GrayAt(13, 5).Y)
+	assert.Equal(t, uint8(200), resized.GrayAt(14, 5).Y)
+
+	// Sub image is resized from its own origin
+	sub := img.SubImage(image.Rect(28, 0, 56, 28)).(*image.Gray)
+	resizedSub := resize(*sub, 28, 28)
+	assert.Equal(t, uint8(200), resizedSub.GrayAt(0, 0).Y)
+
+	small := image.NewGray(image.Rect(0, 0, 14, 14))
+	small.Pix[small.PixOffset(7, 7)] = 255
+	resizedSmall := resize(*small, 28, 28)
+	assert.Equal(t, uint8(0), resizedSmall.GrayAt(2, 2).Y)
+	assert.True(t, resizedSmall.GrayAt(14, 14).Y > 100)
+}
+
+func TestRecogniseCellErrors(t *testing.T) {
+	defer useDefaultModels(map[string]string{})()
+
+	_, err := RecogniseCell(image.Gray{}, 128)
+	assert.Equal(t, ErrEmptyImage, err)
+
+	_, err = RecogniseCell(*drawOne(), 128)
+	assert.Equal(t, ErrNoNetwork, err)
+
+	digit, confidence := RecogniseDigit(image.Gray{}, 128)
+	assert.Equal(t, 0, digit)
+	assert.Equal(t, 0.0, confidence)
+}
+
+func TestInput(t *testing.T) {
+	defer useDefaultModels(map[string]string{})()
+
+	_, err := Input(image.Gray{})
+	assert.Equal(t, ErrEmptyImage, err)
+	_, err = Input(*drawOne())
+	assert.Equal(t, ErrNoNetwork, err)
+
+	big := image.NewGray(image.Rect(0, 0, 56, 56))
+	for i := range big.Pix {
+		big.Pix[i] = 230
+	}
+	for y := 8; y < 48; y++ {
+		for x := 26; x < 30; x++ {
+			big.Pix[big.PixOffset(x, y)] = 20
+		}
+	}
+
+	input, err := DefaultManifest.Input(*big)
+	assert.Nil(t, err)
+	assert.Len(t, input, InputSize)
+	assert.Equal(t, 0.0, input[0])
+	assert.InDelta(t, 235.0/255, input[13*28+14], 0.0001)
+}
+
+func TestInputFromMNIST(t *testing.T) {
+	pixels := make([]uint8, 28*28, 28*28)
+	pixels[2*28+5] = 255 // x: 5, y: 2
+
+	input := InputFromMNIST(pixels)
+	assert.Len(t, input, InputSize)
+	assert.Equal(t, 1.0, input[5*28+2])
+	assert.Equal(t, 0.0, input[2*28+5])
+
+	// Faint pixels are below Otsu's threshold like in cells
+	for y := 4; y < 24; y++ {
+		pixels[y*28+14] = 250
+	}
+	pixels[10*28+20] = 40
+	input = InputFromMNIST(pixels)
+	assert.InDelta(t, 250.0/255, input[14*28+10], 0.0001)
+	assert.Equal(t, 0.0, input[20*28+10])
+}
+
+func TestRecogniseBatchErrors(t *testing.T) {
+	defer useDefaultModels(map[string]string{})()
+
+	_, err := RecogniseBatch([][]image.Gray{{*drawOne()}})
+	assert.Equal(t, ErrNoNetwork, err)
+
+	nn = NewNetwork()
+	defer func() { nn = nil }()
+
+	_, err = RecogniseBatch([][]image.Gray{{*image.NewGray(image.Rect(0, 0, 10, 10))}})
+	assert.Equal(t, ErrInvalidSize, err)
+
+	recognitions, err := RecogniseBatch([][]image.Gray{{*drawOne(), *drawOne()}})
+	assert.Nil(t, err)
+	assert.Len(t, recognitions, 1)
+	assert.Len(t, recognitions[0], 2)
+	assert.Len(t, recognitions[0][1].Probabilities, 10)
+}
+
+func TestRecogniseBatchLabels(t *testing.T) {
+	m := DefaultManifest
+	m.Kind = KindCNN
+	m.Layers, m.Activators = nil, nil
+	m.CNN = &smallCNN
+	m.Labels = []string{"blank", "7", "1"}
+	cnn, err := NewCNNFromManifest(m)
+	assert.Nil(t, err)
+
+	defer useDefaultModels(map[string]string{})()
+	nn, manifest = cnn, m
+
+	recognitions, err := RecogniseBatch([][]image.Gray{{*drawOne()}})
+	assert.Nil(t, err)
+	recognition := recognitions[0][0]
+	class, confidence := recognition.Probabilities.Best()
+	assert.Equal(t, m.Digit(class), recognition.Digit)
+	assert.Equal(t, confidence, recognition.Confidence)
+	assert.Equal(t, recognition.Probabilities[1], recognition.DigitProbabilities[7])
+	assert.Equal(t, recognition.Probabilities[2], recognition.DigitProbabilities[1])
+}
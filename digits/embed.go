@@ -0,0 +1,40 @@
+package digits
+
+import "strings"
+
+//go:generate go run gen_models.go
+
+// Path of default digit network among embedded models (see models_gen.go)
+const defaultModel = "models/digits.nn"
+
+var defaultModels = embeddedModels
+var defaultLoaded bool // Embedded network is read only once, even when it's missing
+var defaultErr error
+
+func readModel(models map[string]string, name string) (Recogniser, Manifest, error) {
+	data, ok := models[name]
+	if !ok {
+		return nil, DefaultManifest, ErrNoNetwork
+	}
+	return ReadNetwork(strings.NewReader(data))
+}
+
+// Returns network used for recognition with its manifest.
+// Embedded network is loaded on first use, when LoadNetwork was not called.
+func currentNetwork() (Recogniser, Manifest, error) {
+	nnLock.Lock()
+	defer nnLock.Unlock()
+
+	if nn == nil && !defaultLoaded {
+		defaultLoaded = true
+		network, m, err := readModel(defaultModels, defaultModel)
+		if err == nil {
+			nn, manifest = network, m
+		}
+		defaultErr = err
+	}
+	if nn == nil {
+		return nil, manifest, defaultErr
+	}
+	return nn, manifest, nil
+}
@@ -0,0 +1,81 @@
+package digits
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Replaces embedded models and unloads network, returns function restoring embedded models
+func useDefaultModels(models map[string]string) func() {
+	defaultModels, defaultLoaded, defaultErr = models, false, nil
+	nn, manifest = nil, DefaultManifest
+	return func() {
+		defaultModels, defaultLoaded, defaultErr = embeddedModels, false, nil
+		nn, manifest = nil, DefaultManifest
+	}
+}
+
+// models_gen.go has to be regenerated when model files change
+func TestEmbeddedModels(t *testing.T) {
+	data, err := ioutil.ReadFile(defaultModel)
+	assert.Nil(t, err)
+	assert.True(t, string(data) == embeddedModels[defaultModel], "run go generate")
+}
+
+func TestEmbeddedDigitNetwork(t *testing.T) {
+	defer useDefaultModels(embeddedModels)()
+	_, loaded, err := currentNetwork()
+	assert.Nil(t, err)
+	assert.Equal(t, KindCNN, loaded.Kind)
+	assert.Equal(t, DefaultManifest.Labels, loaded.Labels)
+
+	recognition, err := RecogniseCell(*drawOne(), 128)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, recognition.Digit)
+}
+
+func TestDefaultNetwork(t *testing.T) {
+	m := DefaultManifest
+	m.Kind = KindCNN
+	m.Layers, m.Activators = nil, nil
+	m.CNN = &smallCNN
+	cnn, err := NewCNNFromManifest(m)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, SaveNetwork(&buf, cnn, m))
+	models := map[string]string{defaultModel: buf.String()}
+
+	defer useDefaultModels(models)()
+	network, loaded, err := currentNetwork()
+	assert.Nil(t, err)
+	assert.Equal(t, m, loaded)
+	assert.Equal(t, cnn.Evaluate(make([]float64, InputSize)), network.Evaluate(make([]float64, InputSize)))
+
+	recognition, err := RecogniseCell(*drawOne(), 128)
+	assert.Nil(t, err)
+	assert.Len(t, recognition.Probabilities, 10)
+
+	// Network loaded before is not replaced
+	useDefaultModels(models)
+	nn = NewNetwork()
+	network, loaded, err = currentNetwork()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultManifest, loaded)
+	assert.Equal(t, nn, network)
+
+	// Missing or broken model
+	useDefaultModels(map[string]string{})
+	_, _, err = currentNetwork()
+	assert.Equal(t, ErrNoNetwork, err)
+
+	useDefaultModels(map[string]string{defaultModel: modelMagic + "{\n"})
+	_, _, err = currentNetwork()
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNoNetwork, err)
+	_, _, err = currentNetwork() // Not read again
+	assert.NotNil(t, err)
+}
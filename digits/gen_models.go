@@ -0,0 +1,55 @@
+//go:build ignore
+// +build ignore
+
+// Writes models_gen.go with network files from models folder,
+// so default networks are compiled in without go:embed (App Engine runs Go 1.9).
+// Run with: go generate ./digits
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+)
+
+const (
+	modelsDir = "models"
+	output    = "models_gen.go"
+)
+
+func main() {
+	infos, err := ioutil.ReadDir(modelsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by go run gen_models.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package digits\n\n")
+	buf.WriteString("// Network files of models folder, keyed by path\n")
+	buf.WriteString("var embeddedModels = map[string]string{\n")
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".nn") {
+			continue
+		}
+		name := path.Join(modelsDir, info.Name())
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Fprintf(&buf, "\t%q: \"", name)
+		for _, b := range data {
+			fmt.Fprintf(&buf, "\\x%02x", b)
+		}
+		buf.WriteString("\",\n")
+	}
+	buf.WriteString("}\n")
+
+	if err := ioutil.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
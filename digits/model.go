@@ -0,0 +1,281 @@
+package digits
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/mrfuxi/neural"
+)
+
+// Model files start with this line followed by manifest (JSON in one line) and weights.
+// Files without it are loaded as DefaultManifest network.
+const modelMagic = "SUDOKU-NN\n"
+
+// NormalisationInk: pixels darker than threshold become ink, scaled to 0-1 (1 is black), rest is 0
+const NormalisationInk = "ink"
+
+// Kinds of networks
+const (
+	KindMLP = "mlp" // Fully connected network from neural package
+	KindCNN = "cnn" // Convolutional network, see CNN
+)
+
+// Recogniser turns input of the network into probabilities of every class
+type Recogniser interface {
+	Evaluate(input []float64) []float64
+}
+
+// BatchRecogniser evaluates many inputs in one call, without locking
+type BatchRecogniser interface {
+	Recogniser
+	EvaluateBatch(inputs [][]float64) [][]float64
+}
+
+// ErrUnsupportedModel is reported when model file describes network that can't be built
+var ErrUnsupportedModel = errors.New("Unsupported model")
+
+// Manifest describes network stored in a model file
+type Manifest struct {
+	Kind          string     `json:"kind,omitempty"`       // KindMLP when empty
+	Layers        []int      `json:"layers,omitempty"`     // MLP: sizes of layers, the first one is input
+	Activators    []string   `json:"activators,omitempty"` // MLP: for every layer but input, sigmoid or softmax
+	CNN           *CNNConfig `json:"cnn,omitempty"`        // CNN: architecture
+	InputWidth    int        `json:"inputWidth"`           // Size of image given to the network
+	InputHeight   int        `json:"inputHeight"`
+	Normalisation string     `json:"normalisation"` // How pixels are turned into input
+	Labels        []string   `json:"labels"`        // Class of every output, digits are recognised by their value
+}
+
+// DefaultManifest describes network trained on MNIST, used before model files had manifest
+var DefaultManifest = Manifest{
+	Layers:        []int{InputSize, 100, 10},
+	Activators:    []string{"sigmoid", "softmax"},
+	InputWidth:    28,
+	InputHeight:   28,
+	Normalisation: NormalisationInk,
+	Labels:        []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+}
+
+// Digit recognised as given class (index of network output), -1 when the class
+// is not a digit, e.g. blank cell
+func (m Manifest) Digit(class int) int {
+	if class < 0 || class >= len(m.Labels) {
+		return -1
+	}
+	digit, err := strconv.Atoi(m.Labels[class])
+	if err != nil || digit < 0 {
+		return -1
+	}
+	return digit
+}
+
+// DigitProbabilities rearranges output of the network, so probabilities are indexed
+// by digit (at least 0-9). Classes which are not digits are left out.
+func (m Manifest) DigitProbabilities(output []float64) Probabilities {
+	size := 10
+	for class := range m.Labels {
+		size = maxInt(size, m.Digit(class)+1)
+	}
+
+	probabilities := make(Probabilities, size, size)
+	for class, p := range output {
+		if digit := m.Digit(class); digit >= 0 {
+			probabilities[digit] += p
+		}
+	}
+	return probabilities
+}
+
+// Recognition from output of the network
+func (m Manifest) recognition(output []float64) Recognition {
+	probabilities := append(Probabilities{}, output...)
+	best, confidence := probabilities.Best()
+	return Recognition{
+		Digit:              m.Digit(best),
+		Confidence:         confidence,
+		Probabilities:      probabilities,
+		DigitProbabilities: m.DigitProbabilities(output),
+	}
+}
+
+// Validate checks that network described by manifest can be built
+func (m Manifest) Validate() error {
+	if m.InputWidth <= 0 || m.InputHeight <= 0 {
+		return fmt.Errorf("%v: invalid size of input image", ErrUnsupportedModel)
+	}
+	if m.Normalisation != NormalisationInk {
+		return fmt.Errorf("%v: unknown normalisation %v", ErrUnsupportedModel, m.Normalisation)
+	}
+
+	switch m.Kind {
+	case "", KindMLP:
+		return m.validateMLP()
+	case KindCNN:
+		return m.validateCNN()
+	}
+	return fmt.Errorf("%v: unknown kind %v", ErrUnsupportedModel, m.Kind)
+}
+
+func (m Manifest) validateCNN() error {
+	c := m.CNN
+	if c == nil || c.Filters <= 0 || c.KernelSize <= 0 || c.PoolSize <= 0 || c.Hidden <= 0 {
+		return fmt.Errorf("%v: invalid CNN architecture", ErrUnsupportedModel)
+	}
+	if (m.InputWidth-c.KernelSize+1)/c.PoolSize <= 0 || (m.InputHeight-c.KernelSize+1)/c.PoolSize <= 0 {
+		return fmt.Errorf("%v: input image too small for CNN", ErrUnsupportedModel)
+	}
+	if len(m.Labels) == 0 {
+		return fmt.Errorf("%v: expected labels", ErrUnsupportedModel)
+	}
+	return nil
+}
+
+func (m Manifest) validateMLP() error {
+	if len(m.Layers) < 2 || len(m.Activators) != len(m.Layers)-1 {
+		return fmt.Errorf("%v: expected activator for every layer but input", ErrUnsupportedModel)
+	}
+	if m.Layers[0] != m.InputWidth*m.InputHeight {
+		return fmt.Errorf("%v: input layer does not match input image", ErrUnsupportedModel)
+	}
+	if len(m.Labels) != m.Layers[len(m.Layers)-1] {
+		return fmt.Errorf("%v: expected label for every output", ErrUnsupportedModel)
+	}
+	for _, name := range m.Activators {
+		if _, ok := layerFactory(name); !ok {
+			return fmt.Errorf("%v: unknown activator %v", ErrUnsupportedModel, name)
+		}
+	}
+	return nil
+}
+
+// Fully connected layer with given activator
+func layerFactory(activator string) (neural.LayerFactory, bool) {
+	switch activator {
+	case "sigmoid":
+		return neural.NewFullyConnectedLayer(neural.NewSigmoidActivator()), true
+	case "softmax":
+		return neural.NewFullyConnectedLayer(neural.NewSoftmaxActivator()), true
+	}
+	return nil, false
+}
+
+// NewNetworkFromManifest creates untrained fully connected network described by manifest
+func NewNetworkFromManifest(m Manifest) (neural.Evaluator, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if m.Kind == KindCNN {
+		return nil, fmt.Errorf("%v: use NewCNNFromManifest", ErrUnsupportedModel)
+	}
+
+	layers := make([]neural.LayerFactory, len(m.Activators), len(m.Activators))
+	for i, name := range m.Activators {
+		layers[i], _ = layerFactory(name)
+	}
+	return neural.NewNeuralNetwork(m.Layers, layers...), nil
+}
+
+// NewNetwork creates untrained network described by DefaultManifest
+func NewNetwork() neural.Evaluator {
+	network, _ := NewNetworkFromManifest(DefaultManifest)
+	return network
+}
+
+// NewCNNFromManifest creates untrained convolutional network described by manifest
+func NewCNNFromManifest(m Manifest) (*CNN, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if m.Kind != KindCNN {
+		return nil, fmt.Errorf("%v: use NewNetworkFromManifest", ErrUnsupportedModel)
+	}
+	return NewCNN(*m.CNN, m.InputWidth, m.InputHeight, len(m.Labels), 1), nil
+}
+
+// Network of the right kind described by manifest, weights are read from reader
+func readRecogniser(m Manifest, r io.Reader) (Recogniser, error) {
+	if m.Kind == KindCNN {
+		network, err := NewCNNFromManifest(m)
+		if err != nil {
+			return nil, err
+		}
+		return network, network.Load(r)
+	}
+
+	network, err := NewNetworkFromManifest(m)
+	if err != nil {
+		return nil, err
+	}
+	return network, neural.Load(network, r)
+}
+
+// SaveNetwork writes model file: manifest followed by weights of the network.
+// Network is either *CNN or neural.Evaluator.
+func SaveNetwork(w io.Writer, network Recogniser, m Manifest) error {
+	if _, err := io.WriteString(w, modelMagic); err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(m); err != nil { // Single line
+		return err
+	}
+
+	switch network := network.(type) {
+	case *CNN:
+		return network.Save(w)
+	case neural.Evaluator:
+		return neural.Save(network, w)
+	}
+	return ErrUnsupportedModel
+}
+
+// ReadNetwork reads model file and builds network matching its manifest.
+// Files without manifest are read as DefaultManifest network.
+func ReadNetwork(r io.Reader) (Recogniser, Manifest, error) {
+	reader := bufio.NewReader(r)
+	m := DefaultManifest
+
+	header, err := reader.Peek(len(modelMagic))
+	if err == nil && bytes.Equal(header, []byte(modelMagic)) {
+		reader.Discard(len(modelMagic))
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, m, err
+		}
+		m = Manifest{}
+		if err := json.Unmarshal(line, &m); err != nil {
+			return nil, m, err
+		}
+	}
+
+	network, err := readRecogniser(m, reader)
+	if err != nil {
+		return nil, m, err
+	}
+	return network, m, nil
+}
+
+// LoadNetwork intializes global neural network used to process digits,
+// it's used instead of embedded one
+func LoadNetwork(fileName string) {
+	fn, err := os.Open(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fn.Close()
+
+	network, m, err := ReadNetwork(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	nnLock.Lock()
+	nn, manifest = network, m
+	nnLock.Unlock()
+}
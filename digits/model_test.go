@@ -0,0 +1,91 @@
+package digits
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrfuxi/neural"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestValidate(t *testing.T) {
+	assert.Nil(t, DefaultManifest.Validate())
+
+	small := Manifest{
+		Layers:        []int{16 * 20, 30, 20, 11},
+		Activators:    []string{"sigmoid", "sigmoid", "softmax"},
+		InputWidth:    16,
+		InputHeight:   20,
+		Normalisation: NormalisationInk,
+		Labels:        []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "blank"},
+	}
+	assert.Nil(t, small.Validate())
+
+	invalid := []func(m *Manifest){
+		func(m *Manifest) { m.Layers = []int{784} },
+		func(m *Manifest) { m.Activators = []string{"sigmoid"} },
+		func(m *Manifest) { m.Activators = []string{"sigmoid", "tanh"} },
+		func(m *Manifest) { m.InputWidth = 20 },
+		func(m *Manifest) { m.Labels = m.Labels[:9] },
+		func(m *Manifest) { m.Normalisation = "raw" },
+	}
+	for i, change := range invalid {
+		m := DefaultManifest
+		m.Layers = append([]int{}, DefaultManifest.Layers...)
+		change(&m)
+		assert.NotNil(t, m.Validate(), "Case %v", i)
+	}
+
+	_, err := NewNetworkFromManifest(Manifest{})
+	assert.NotNil(t, err)
+}
+
+func TestSaveAndReadNetwork(t *testing.T) {
+	m := DefaultManifest
+	m.Layers = []int{InputSize, 50, 10}
+	m.Activators = []string{"sigmoid", "softmax"}
+
+	network, err := NewNetworkFromManifest(m)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, SaveNetwork(&buf, network, m))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte(modelMagic)))
+
+	loaded, manifest, err := ReadNetwork(&buf)
+	assert.Nil(t, err)
+	assert.NotNil(t, loaded)
+	assert.Equal(t, m, manifest)
+}
+
+func TestReadNetworkWithoutManifest(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, neural.Save(NewNetwork(), &buf))
+
+	loaded, manifest, err := ReadNetwork(&buf)
+	assert.Nil(t, err)
+	assert.NotNil(t, loaded)
+	assert.Equal(t, DefaultManifest, manifest)
+}
+
+func TestManifestDigits(t *testing.T) {
+	m := DefaultManifest
+	m.Labels = []string{"blank", "3", "1", "12"}
+
+	assert.Equal(t, -1, m.Digit(0))
+	assert.Equal(t, 3, m.Digit(1))
+	assert.Equal(t, 12, m.Digit(3))
+	assert.Equal(t, -1, m.Digit(4))
+	assert.Equal(t, 7, DefaultManifest.Digit(7))
+
+	probabilities := m.DigitProbabilities([]float64{0.4, 0.3, 0.2, 0.1})
+	assert.Len(t, probabilities, 13)
+	assert.Equal(t, 0.3, probabilities[3])
+	assert.Equal(t, 0.2, probabilities[1])
+	assert.Equal(t, 0.1, probabilities[12])
+	assert.Equal(t, 0.0, probabilities[0])
+
+	recognition := m.recognition([]float64{0.4, 0.3, 0.2, 0.1})
+	assert.Equal(t, -1, recognition.Digit) // Blank cell
+	assert.Equal(t, 0.4, recognition.Confidence)
+}
@@ -0,0 +1,178 @@
+package sudoku
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+// ErrInvalidGeometry is reported when decoded geometry does not describe a grid
+var ErrInvalidGeometry = errors.New("Invalid geometry of sudoku grid")
+
+// Point on the image with sub-pixel precision
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Geometry describes where the puzzle is on the image.
+// Cell coordinates go from (0, 0) in top-left corner of the grid
+// to (Size.Cells, Size.Cells) in bottom-right one, so centre of the cell
+// in row 2 and column 5 is at (5.5, 2.5).
+type Geometry struct {
+	Size GridSize
+	// Outer corners of the grid: top-left, top-right, bottom-right, bottom-left
+	Corners [4]Point
+	// Intersections of all grid lines indexed [row][col]
+	Intersections [][]Corner
+	// Homography maps cell coordinates (col, row, 1) to image coordinates.
+	// In mesh mode it's fitted to all intersections, points are mapped through
+	// their own cells instead.
+	Homography [3][3]float64
+	// Mesh tells that every cell is mapped by homography of its own corners
+	Mesh bool
+
+	toImage *perspectiveTrasnformation
+	toCell  *perspectiveTrasnformation
+
+	// Mesh mode only: corners of cells [row][col] and their own homographies
+	mesh        [][]pointF
+	cellToImage [][]*perspectiveTrasnformation
+	cellToCell  [][]*perspectiveTrasnformation
+}
+
+// Builds geometry from homography mapping original image onto cell coordinates.
+// In mesh mode every cell is mapped by homography of its own corners.
+func newGeometry(size GridSize, intersections [][]Corner, imageToCell *perspectiveTrasnformation, meshMode bool) *Geometry {
+	g := &Geometry{
+		Size:          size,
+		Intersections: make([][]Corner, len(intersections), len(intersections)),
+		Mesh:          meshMode,
+		toImage:       imageToCell.inverse(),
+		toCell:        imageToCell,
+	}
+
+	for row := range intersections {
+		g.Intersections[row] = append([]Corner{}, intersections[row]...)
+	}
+
+	if meshMode {
+		g.mesh = cornerPoints(intersections)
+		rows, cols := len(g.mesh)-1, len(g.mesh[0])-1
+		g.cellToImage = make([][]*perspectiveTrasnformation, rows, rows)
+		g.cellToCell = make([][]*perspectiveTrasnformation, rows, rows)
+		for row := 0; row < rows; row++ {
+			g.cellToImage[row] = make([]*perspectiveTrasnformation, cols, cols)
+			g.cellToCell[row] = make([]*perspectiveTrasnformation, cols, cols)
+			for col := 0; col < cols; col++ {
+				x, y := float64(col), float64(row)
+				cell := [4]pointF{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}}
+				g.cellToCell[row][col] = newPerspective(cellCorners(g.mesh, row, col), cell)
+				g.cellToImage[row][col] = g.cellToCell[row][col].inverse()
+			}
+		}
+	}
+
+	g.Homography = g.toImage.Matrix()
+	last := float64(size.Cells)
+	for i, pt := range [4]Point{{0, 0}, {last, 0}, {last, last}, {0, last}} {
+		x, y := g.ToImage(pt.X, pt.Y)
+		g.Corners[i] = Point{x, y}
+	}
+	return g
+}
+
+// Copy which can be modified by the caller, homographies are shared
+func (g *Geometry) copy() *Geometry {
+	c := *g
+	c.Intersections = make([][]Corner, len(g.Intersections), len(g.Intersections))
+	for row := range g.Intersections {
+		c.Intersections[row] = append([]Corner{}, g.Intersections[row]...)
+	}
+	return &c
+}
+
+// UnmarshalJSON decodes geometry encoded with encoding/json. Mappings between
+// the image and cells are rebuilt from Homography and Intersections.
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	type fields Geometry // Without methods, so it's decoded field by field
+	var f fields
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+
+	if !f.Size.Valid() || len(f.Intersections) != f.Size.Lines() {
+		return ErrInvalidGeometry
+	}
+	for _, row := range f.Intersections {
+		if len(row) != f.Size.Lines() {
+			return ErrInvalidGeometry
+		}
+	}
+
+	toImage := perspectiveFromMatrix(f.Homography)
+	toCell := toImage.inverse()
+	det := toImage.H11*toCell.H11 + toImage.H12*toCell.H21 + toImage.H13*toCell.H31
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return ErrInvalidGeometry
+	}
+
+	*g = *newGeometry(f.Size, f.Intersections, toCell, f.Mesh)
+	return nil
+}
+
+// ToImage maps cell coordinates to position on the image
+func (g *Geometry) ToImage(col, row float64) (x, y float64) {
+	if g.cellToImage == nil || math.IsNaN(col) || math.IsNaN(row) {
+		return g.toImage.Project(col, row)
+	}
+
+	// Points outside of the grid are extrapolated from the closest cell
+	last := float64(len(g.cellToImage) - 1)
+	r := int(math.Max(0, math.Min(last, math.Floor(row))))
+	last = float64(len(g.cellToImage[r]) - 1)
+	c := int(math.Max(0, math.Min(last, math.Floor(col))))
+	return g.cellToImage[r][c].Project(col, row)
+}
+
+// ToCell maps position on the image to cell coordinates
+func (g *Geometry) ToCell(x, y float64) (col, row float64) {
+	if g.cellToCell != nil {
+		pt := pointF{x, y}
+		for r := range g.cellToCell {
+			for c := range g.cellToCell[r] {
+				if insideQuad(cellCorners(g.mesh, r, c), pt) {
+					return g.cellToCell[r][c].Project(x, y)
+				}
+			}
+		}
+	}
+	return g.toCell.Project(x, y)
+}
+
+// Tells whether point is inside convex quadrilateral or on its edge,
+// corners go clockwise or counter-clockwise
+func insideQuad(quad [4]pointF, pt pointF) bool {
+	positive, negative := false, false
+	for i, a := range quad {
+		b := quad[(i+1)%4]
+		cross := (b.X-a.X)*(pt.Y-a.Y) - (b.Y-a.Y)*(pt.X-a.X)
+		positive = positive || cross > 0
+		negative = negative || cross < 0
+	}
+	return !(positive && negative)
+}
+
+// CellAt finds cell containing given point of the image
+func (g *Geometry) CellAt(x, y float64) (row, col int, ok bool) {
+	cellX, cellY := g.ToCell(x, y)
+	if math.IsNaN(cellX) || math.IsNaN(cellY) || cellX < 0 || cellY < 0 {
+		return 0, 0, false
+	}
+
+	row, col = int(cellY), int(cellX)
+	if row >= g.Size.Cells || col >= g.Size.Cells {
+		return 0, 0, false
+	}
+	return row, col, true
+}
@@ -0,0 +1,221 @@
+package sudoku
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+
+	"github.com/mrfuxi/sudoku/digits"
+	"github.com/stretchr/testify/assert"
+)
+
+// Recognised 4x4 sudoku with cells 20px wide starting at (10, 30)
+func recognisedSudoku() *lineSudoku {
+	corners := make([][]Corner, 5, 5)
+	for row := range corners {
+		corners[row] = make([]Corner, 5, 5)
+		for col := range corners[row] {
+			corners[row][col] = Corner{X: float64(10 + col*20), Y: float64(30 + row*20), Confidence: 1}
+		}
+	}
+	return &lineSudoku{
+		Size:          Grid4x4,
+		Intersections: corners,
+		Recognised:    true,
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	s := recognisedSudoku()
+	g := s.Geometry()
+
+	assert.Equal(t, Grid4x4, g.Size)
+	assert.Len(t, g.Intersections, 5)
+	assert.Equal(t, s.Intersections, g.Intersections)
+
+	expectedCorners := [4]Point{{10, 30}, {90, 30}, {90, 110}, {10, 110}}
+	for i, corner := range g.Corners {
+		assert.InDelta(t, expectedCorners[i].X, corner.X, 0.001)
+		assert.InDelta(t, expectedCorners[i].Y, corner.Y, 0.001)
+	}
+
+	expectedHomography := [3][3]float64{
+		{20, 0, 10},
+		{0, 20, 30},
+		{0, 0, 1},
+	}
+	for i := range expectedHomography {
+		for j := range expectedHomography[i] {
+			assert.InDelta(t, expectedHomography[i][j], g.Homography[i][j], 0.001)
+		}
+	}
+
+	x, y := g.ToImage(1.5, 2.5) // Centre of a cell
+	assert.InDelta(t, 40, x, 0.001)
+	assert.InDelta(t, 80, y, 0.001)
+
+	col, row := g.ToCell(40, 80)
+	assert.InDelta(t, 1.5, col, 0.001)
+	assert.InDelta(t, 2.5, row, 0.001)
+
+	// Copy of intersections
+	g.Intersections[0][0].X = 0
+	assert.Equal(t, 10.0, s.Intersections[0][0].X)
+}
+
+func TestGeometryCached(t *testing.T) {
+	s := recognisedSudoku()
+	g := s.Geometry()
+	g.Intersections[1][1].X = 0
+
+	// Computed once, later changes of intersections don't matter
+	s.Intersections[0][0].X = 0
+	again := s.Geometry()
+	assert.Equal(t, 30.0, again.Intersections[1][1].X)
+	assert.Equal(t, 10.0, again.Intersections[0][0].X)
+	assert.Equal(t, g.Homography, again.Homography)
+}
+
+func TestGeometryMesh(t *testing.T) {
+	s := recognisedSudoku()
+	s.MeshMode = true
+	s.Intersections[2][2] = Corner{X: 56, Y: 76, Confidence: 1} // Bent lines, should be (50, 70)
+	g := s.Geometry()
+
+	// Intersections are mapped exactly, no matter the homography of the whole grid
+	x, y := g.ToImage(2, 2)
+	assert.InDelta(t, 56, x, 0.001)
+	assert.InDelta(t, 76, y, 0.001)
+	col, row := g.ToCell(56, 76)
+	assert.InDelta(t, 2, col, 0.001)
+	assert.InDelta(t, 2, row, 0.001)
+
+	// Centre of the cell on its own corners
+	x, y = g.ToImage(1.5, 1.5)
+	col, row = g.ToCell(x, y)
+	assert.InDelta(t, 1.5, col, 0.001)
+	assert.InDelta(t, 1.5, row, 0.001)
+
+	// Point right of the straight line is still in the bent cell
+	r, c, ok := s.CellAt(53, 74)
+	assert.True(t, ok)
+	assert.Equal(t, 1, r)
+	assert.Equal(t, 1, c)
+
+	// Unchanged cells map like the whole grid
+	col, row = g.ToCell(15, 35)
+	assert.InDelta(t, 0.25, col, 0.001)
+	assert.InDelta(t, 0.25, row, 0.001)
+
+	// Outside of the grid
+	_, _, ok = s.CellAt(95, 50)
+	assert.False(t, ok)
+}
+
+func TestGeometryJSON(t *testing.T) {
+	s := recognisedSudoku()
+	s.MeshMode = true
+	s.Intersections[2][2] = Corner{X: 56, Y: 76, Confidence: 1}
+	g := s.Geometry()
+
+	data, err := json.Marshal(g)
+	assert.Nil(t, err)
+	var decoded Geometry
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+
+	assert.Equal(t, g.Size, decoded.Size)
+	assert.Equal(t, g.Intersections, decoded.Intersections)
+	assert.True(t, decoded.Mesh)
+	for _, pt := range []Point{{15, 35}, {53, 74}, {56, 76}, {85, 105}} {
+		col, row := g.ToCell(pt.X, pt.Y)
+		decodedCol, decodedRow := decoded.ToCell(pt.X, pt.Y)
+		assert.InDelta(t, col, decodedCol, 0.001)
+		assert.InDelta(t, row, decodedRow, 0.001)
+	}
+	for i, corner := range g.Corners {
+		assert.InDelta(t, corner.X, decoded.Corners[i].X, 0.001)
+		assert.InDelta(t, corner.Y, decoded.Corners[i].Y, 0.001)
+	}
+
+	testCases := []string{
+		`{"Size": {"Cells": 4, "BoxWidth": 3, "BoxHeight": 2}}`,
+		`{"Size": {"Cells": 4, "BoxWidth": 2, "BoxHeight": 2}, "Intersections": [[]]}`,
+		`{"Size": {"Cells": 4, "BoxWidth": 2, "BoxHeight": 2}, "Homography": [[0, 0, 0], [0, 0, 0], [0, 0, 1]]}`,
+	}
+	for _, tc := range testCases {
+		var invalid Geometry
+		assert.Equal(t, ErrInvalidGeometry, json.Unmarshal([]byte(tc), &invalid), tc)
+	}
+
+	// Valid grid with degenerate homography
+	g.Homography = [3][3]float64{{1, 2, 0}, {2, 4, 0}, {0, 0, 1}}
+	data, err = json.Marshal(g)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrInvalidGeometry, json.Unmarshal(data, &decoded))
+}
+
+func TestInsideQuad(t *testing.T) {
+	quad := [4]pointF{{0, 0}, {10, 0}, {12, 10}, {0, 8}}
+	assert.True(t, insideQuad(quad, pointF{5, 5}))
+	assert.True(t, insideQuad(quad, pointF{0, 4})) // Edge
+	assert.True(t, insideQuad(quad, pointF{11, 8}))
+	assert.False(t, insideQuad(quad, pointF{-1, 4}))
+	assert.False(t, insideQuad(quad, pointF{5, 11}))
+}
+
+func TestGeometryNotRecognised(t *testing.T) {
+	s := &lineSudoku{}
+	assert.Nil(t, s.Geometry())
+	_, err := s.Digits()
+	assert.Equal(t, ErrNotRecognised, err)
+}
+
+func TestDigitsError(t *testing.T) {
+	s := recognisedSudoku()
+	s.DigitsErr = digits.ErrNoNetwork
+	cells, err := s.Digits()
+	assert.Nil(t, cells)
+	assert.Equal(t, digits.ErrNoNetwork, err)
+}
+
+func TestCellAt(t *testing.T) {
+	s := recognisedSudoku()
+
+	testCases := []struct {
+		x, y     float64
+		row, col int
+		ok       bool
+	}{
+		{15, 35, 0, 0, true},
+		{40, 80, 2, 1, true},
+		{89.9, 109.9, 3, 3, true},
+		{90, 50, 0, 0, false}, // Right border
+		{5, 50, 0, 0, false},
+		{50, 20, 0, 0, false},
+		{50, 200, 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		row, col, ok := s.CellAt(tc.x, tc.y)
+		assert.Equal(t, tc.ok, ok, "Point %v, %v", tc.x, tc.y)
+		assert.Equal(t, tc.row, row, "Point %v, %v", tc.x, tc.y)
+		assert.Equal(t, tc.col, col, "Point %v, %v", tc.x, tc.y)
+	}
+
+	_, _, ok := (&lineSudoku{}).CellAt(15, 35)
+	assert.False(t, ok)
+}
+
+func TestExtractedWithOptions(t *testing.T) {
+	s := recognisedSudoku()
+	s.BaseImage = image.NewRGBA(image.Rect(0, 0, 100, 120))
+
+	assert.IsType(t, &image.Gray{}, s.Extracted(40))
+	assert.IsType(t, &image.RGBA{}, s.ExtractedWithOptions(ExtractOptions{Width: 40, Height: 20, Color: true}))
+	nrgba := s.ExtractedWithOptions(ExtractOptions{Width: 40, Height: 20, Color: true, NonPremultiplied: true})
+	assert.IsType(t, &image.NRGBA{}, nrgba)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), nrgba.Bounds())
+
+	assert.Nil(t, s.Extracted(0))
+	assert.Nil(t, s.ExtractedWithOptions(ExtractOptions{Width: 40, Height: -1}))
+}
@@ -13,6 +13,26 @@ type lineGrid struct {
 	Horizontal []polarLine
 	Vertical   []polarLine
 	Score      float64
+	Coverage   float64 // Fraction (0-1) of grid lines found on the image, set by evaluateGrids
+	BoxScore   float64 // How much box borders are thicker than other lines
+}
+
+// Scaled maps grid found on image resized by 1/scale back to original image
+func (g lineGrid) Scaled(scale float64) lineGrid {
+	scaled := lineGrid{
+		Horizontal: make([]polarLine, len(g.Horizontal), len(g.Horizontal)),
+		Vertical:   make([]polarLine, len(g.Vertical), len(g.Vertical)),
+		Score:      g.Score,
+		Coverage:   g.Coverage,
+		BoxScore:   g.BoxScore,
+	}
+	for i, line := range g.Horizontal {
+		scaled.Horizontal[i] = line.Scaled(scale)
+	}
+	for i, line := range g.Vertical {
+		scaled.Vertical[i] = line.Scaled(scale)
+	}
+	return scaled
 }
 
 type lineGridByScore []lineGrid
@@ -21,6 +41,56 @@ func (a lineGridByScore) Len() int           { return len(a) }
 func (a lineGridByScore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a lineGridByScore) Less(i, j int) bool { return a[i].Score > a[j].Score } // Reversed order most to least
 
+// Orders from the best to the worst grid by score weighted by coverage
+type lineGridByCoverage []lineGrid
+
+func (a lineGridByCoverage) Len() int      { return len(a) }
+func (a lineGridByCoverage) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a lineGridByCoverage) Less(i, j int) bool {
+	return a[i].Score*a[i].Coverage > a[j].Score*a[j].Coverage // Reversed order most to least
+}
+
+// Orders grids by position on the image: top to bottom, left to right.
+// Grids which vertically overlap by more than half are considered to be in the same row.
+type lineGridByPosition []lineGrid
+
+func (a lineGridByPosition) Len() int      { return len(a) }
+func (a lineGridByPosition) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a lineGridByPosition) Less(i, j int) bool {
+	boundsI, boundsJ := a[i].Bounds(), a[j].Bounds()
+	top, bottom := maxInt(boundsI.Min.Y, boundsJ.Min.Y), minInt(boundsI.Max.Y, boundsJ.Max.Y)
+	if bottom-top > minInt(boundsI.Dy(), boundsJ.Dy())/2 {
+		return boundsI.Min.X < boundsJ.Min.X
+	}
+	return boundsI.Min.Y < boundsJ.Min.Y
+}
+
+// Corners returns corners of the grid: top-left, top-right, bottom-right, bottom-left
+func (g lineGrid) Corners() [4]image.Point {
+	first, last := len(g.Horizontal)-1, len(g.Vertical)-1
+	_, p1 := intersection(g.Horizontal[0], g.Vertical[0])
+	_, p2 := intersection(g.Horizontal[0], g.Vertical[last])
+	_, p3 := intersection(g.Horizontal[first], g.Vertical[last])
+	_, p4 := intersection(g.Horizontal[first], g.Vertical[0])
+	return [4]image.Point{p1, p2, p3, p4}
+}
+
+// Bounds returns the smallest rectangle containing the grid
+func (g lineGrid) Bounds() image.Rectangle {
+	corners := g.Corners()
+	bounds := image.Rectangle{corners[0], corners[0].Add(image.Point{1, 1})}
+	for _, corner := range corners[1:] {
+		bounds = bounds.Union(image.Rectangle{corner, corner.Add(image.Point{1, 1})})
+	}
+	return bounds
+}
+
+// Two grids are considered the same puzzle when they cover the same area,
+// grids sharing lines in both directions (e.g. shifted by a cell) always do
+func gridsOverlap(a, b lineGrid) bool {
+	return a.Bounds().Overlaps(b.Bounds())
+}
+
 type scoredLines struct {
 	Lines []polarLine
 	Score float64
@@ -62,12 +132,19 @@ func minInt(a, b int) int {
 	return b
 }
 
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 // Builds possible line grouppings by using muiltple "cutting" lines
-func buildScoredLines(primary, secondary []polarLine, top uint) []scoredLines {
+func buildScoredLines(primary, secondary []polarLine, count int, top uint) []scoredLines {
 	lines := make(map[string]scoredLines, 0)
 	scores := make(map[string]*meanAcc, 0)
 	for _, s := range secondary {
-		matches := linearDistances(primary, s)
+		matches := linearDistances(primary, s, count)
 		for _, match := range matches {
 			hash := match.HashKey()
 			if scores[hash] == nil {
@@ -91,13 +168,15 @@ func buildScoredLines(primary, secondary []polarLine, top uint) []scoredLines {
 	return scoredLn[:minInt(int(top), len(scoredLn))]
 }
 
-func possibleGrids(horizontal, vertical []polarLine) []lineGrid {
+// Combines best sets of count lines in both directions into grids,
+// top limits number of line sets taken in each direction
+func possibleGrids(horizontal, vertical []polarLine, count int, top uint) []lineGrid {
 	// Make sure lines are ordered correctly
 	sort.Sort(polarLinesByDistance(vertical))
 	sort.Sort(polarLinesByDistance(horizontal))
 
-	linesH := buildScoredLines(horizontal, vertical, 3)
-	linesV := buildScoredLines(vertical, horizontal, 3)
+	linesH := buildScoredLines(horizontal, vertical, count, top)
+	linesV := buildScoredLines(vertical, horizontal, count, top)
 
 	var grids []lineGrid
 	for _, h := range linesH {
@@ -116,8 +195,11 @@ func possibleGrids(horizontal, vertical []polarLine) []lineGrid {
 	return grids
 }
 
+// Sets Coverage of every grid by lines found on the image.
+// Grids are sorted by score, coverage does not change which grid is the best.
 func evaluateGrids(src image.Gray, grids []lineGrid) []lineGrid {
-	for _, grid := range grids {
+	for i := range grids {
+		grid := &grids[i]
 		hCount := len(grid.Horizontal)
 		vCount := len(grid.Vertical)
 		fragments := make([]lineFragment, hCount+vCount)
@@ -141,14 +223,17 @@ func evaluateGrids(src image.Gray, grids []lineGrid) []lineGrid {
 		score := 0.0
 		for _, fragment := range fragments {
 			points := pointsOnLineFragment(fragment)
-			value := 1.0 / fragment.Length()
+			found := 0
 			for _, point := range points {
 				if src.Pix[src.PixOffset(point.X, point.Y)] != 0 {
-					score += value
+					found++
 				}
 			}
+			if len(points) != 0 {
+				score += float64(found) / float64(len(points))
+			}
 		}
-		grid.Score = grid.Score * score / float64(len(fragments))
+		grid.Coverage = score / float64(len(fragments))
 	}
 
 	sort.Sort(lineGridByScore(grids))
@@ -156,13 +241,42 @@ func evaluateGrids(src image.Gray, grids []lineGrid) []lineGrid {
 	return grids
 }
 
-// Splits lines into groups of 10 with score of how much linearly distributed they are
-func linearDistances(lines []polarLine, dividerLine polarLine) []scoredLines {
+// Builds grid of cells x cells with lines equally distributed inside of quadrilateral
+// given by corners: top-left, top-right, bottom-right, bottom-left
+func gridFromCorners(corners [4]pointF, cells int) lineGrid {
+	last := float64(cells)
+	cellCorners := [4]pointF{
+		pointF{0, 0},
+		pointF{last, 0},
+		pointF{last, last},
+		pointF{0, last},
+	}
+	proj := newPerspective(cellCorners, corners)
+
+	grid := lineGrid{
+		Horizontal: make([]polarLine, cells+1, cells+1),
+		Vertical:   make([]polarLine, cells+1, cells+1),
+	}
+	for i := range grid.Horizontal {
+		pos := float64(i)
+		startX, startY := proj.Project(0, pos)
+		endX, endY := proj.Project(last, pos)
+		grid.Horizontal[i] = lineThroughPoints(pointF{startX, startY}, pointF{endX, endY})
+
+		startX, startY = proj.Project(pos, 0)
+		endX, endY = proj.Project(pos, last)
+		grid.Vertical[i] = lineThroughPoints(pointF{startX, startY}, pointF{endX, endY})
+	}
+	return grid
+}
+
+// Splits lines into groups of count lines with score of how much linearly distributed they are
+func linearDistances(lines []polarLine, dividerLine polarLine, count int) []scoredLines {
 	// Lines have to be sorted correctly!
 	var matches []scoredLines
 
 	linesCount := len(lines)
-	if linesCount < 10 {
+	if linesCount < count {
 		return matches
 	}
 
@@ -179,25 +293,25 @@ func linearDistances(lines []polarLine, dividerLine polarLine) []scoredLines {
 
 	distances := preparePointDistances(points)
 
-	expectedPoints := make([]float64, 10, 10)
+	expectedPoints := make([]float64, count, count)
 
-	for i := range points[:linesCount-10+1] {
-		dI := i + 10 - 1
+	for i := range points[:linesCount-count+1] {
+		dI := i + count - 1
 		for j := range points[dI:] {
 			start, end := points[i], points[j+dI]
-			step := (end - start) / 9.0
+			step := (end - start) / float64(count-1)
 			for k := range expectedPoints {
 				expectedPoints[k] = start + step*float64(k)
 			}
-			score, selectedPoints := pointSimilarities(expectedPoints, distances)
+			score, selectedPoints := scaledPointSimilarities(expectedPoints, distances, count-1)
 
-			if len(selectedPoints) != 10 {
+			if len(selectedPoints) != count {
 				continue
 			}
 
 			match := scoredLines{
 				Score: score,
-				Lines: make([]polarLine, 10, 10),
+				Lines: make([]polarLine, count, count),
 			}
 
 			searchablePoints := sort.Float64Slice(points)
@@ -237,11 +351,15 @@ func preparePointDistances(positions []float64) []float64 {
 	return closest
 }
 
-func pointSimilarities(expectedPoints, distances []float64) (float64, []float64) {
+// Fit (0-1) of closest points to expected ones and the points matching them.
+// Deviations are averaged over given number of intervals (cells of the grid),
+// so grids of every size score alike.
+func scaledPointSimilarities(expectedPoints, distances []float64, intervals int) (float64, []float64) {
 	fit := 0.0
 	var matches []float64
 
 	step := expectedPoints[1] - expectedPoints[0]
+	steps := float64(intervals)
 	for _, expected := range expectedPoints {
 		point := distances[int(expected)]
 		if len(matches) > 0 {
@@ -249,7 +367,7 @@ func pointSimilarities(expectedPoints, distances []float64) (float64, []float64)
 			if f >= 0.2 {
 				break
 			}
-			fit += f / 9.0
+			fit += f / steps
 		}
 
 		matches = append(matches, point)
@@ -258,11 +376,15 @@ func pointSimilarities(expectedPoints, distances []float64) (float64, []float64)
 	return (1 - fit), matches
 }
 
-func extractCells(grid lineGrid, img image.Image) (cells [9][9]image.Gray) {
+// Extracts every cell as 28x28 image cleaned like MNIST digits and recognises them,
+// mesh holds corners of cells indexed [row][col].
+// Cells are returned even when recognition fails.
+func extractCells(mesh [][]pointF, img image.Image, deskew bool) (cells [][]image.Gray, recognised [][]RecognisedCell, err error) {
 	grayImg := grayImage(img)
+	rows, cols := len(mesh)-1, len(mesh[0])-1
 
-	margin := 0
-	size := 28.0 // Size of learning data set: MNIST
+	margin := 0.0
+	size := float64(cellWarpSize)
 	dst := [4]pointF{
 		pointF{0, 0},
 		pointF{size, 0},
@@ -270,33 +392,71 @@ func extractCells(grid lineGrid, img image.Image) (cells [9][9]image.Gray) {
 		pointF{0, size},
 	}
 
-	for row := 0; row < 9; row++ {
-		for col := 0; col < 9; col++ {
-			_, p1 := intersection(grid.Horizontal[row], grid.Vertical[col])
-			_, p2 := intersection(grid.Horizontal[row], grid.Vertical[col+1])
-			_, p3 := intersection(grid.Horizontal[row+1], grid.Vertical[col+1])
-			_, p4 := intersection(grid.Horizontal[row+1], grid.Vertical[col])
-
-			p1.Y -= margin
-			p1.X -= margin
-			p2.Y -= margin
-			p2.X += margin
-			p3.X += margin
-			p3.Y += margin
-			p4.X -= margin
-			p4.Y += margin
-
-			src := [4]pointF{
-				newPointF(p1),
-				newPointF(p2),
-				newPointF(p3),
-				newPointF(p4),
-			}
+	cells = make([][]image.Gray, rows, rows)
+	features := make([][]WritingFeatures, rows, rows)
+	notEmpty := make([][]bool, rows, rows)
+	// Tiles of pencil marks in empty cells are recognised with digits, batch row per cell
+	batch := make([][]image.Gray, rows, rows)
+	pencilRows := make([][]int, rows, rows) // Row of the batch, -1 when there are no marks
+	var pencilMarked [][]bool
+	for row := 0; row < rows; row++ {
+		cells[row] = make([]image.Gray, cols, cols)
+		features[row] = make([]WritingFeatures, cols, cols)
+		notEmpty[row] = make([]bool, cols, cols)
+		pencilRows[row] = make([]int, cols, cols)
+		for col := 0; col < cols; col++ {
+			pencilRows[row][col] = -1
+			src := cellCorners(mesh, row, col)
+
+			src[0].Y -= margin
+			src[0].X -= margin
+			src[1].Y -= margin
+			src[1].X += margin
+			src[2].X += margin
+			src[2].Y += margin
+			src[3].X -= margin
+			src[3].Y += margin
+
 			proj := newPerspective(src, dst)
-			cells[row][col] = proj.warpPerspective(grayImg)
+			warped := proj.warpPerspective(grayImg)
+			threshold := otsuValue(warped)
+			digit, box, found := centralComponentBox(inkImage(warped, threshold))
+			if !found || !isFullDigit(digit, warped) {
+				cells[row][col] = blankCell()
+				tiles, marked := pencilTiles(warped, threshold)
+				for _, m := range marked {
+					if m {
+						pencilRows[row][col] = rows + len(pencilMarked)
+						batch = append(batch, tiles)
+						pencilMarked = append(pencilMarked, marked)
+						break
+					}
+				}
+				continue
+			}
 
-			cell := cells[row][col]
-			digit, conf := digits.RecogniseDigit(cell, otsuValue(cell))
+			cells[row][col] = cleanDigit(digit, deskew)
+			features[row][col] = measureWriting(warped, digit, box)
+			notEmpty[row][col] = true
+		}
+	}
+	copy(batch, cells)
+	setHeightDeviation(features, notEmpty)
+
+	recognitions, err := digits.RecogniseBatch(batch)
+	if err != nil {
+		return cells, nil, err
+	}
+	recognised = make([][]RecognisedCell, rows, rows)
+	for row := range cells {
+		recognised[row] = make([]RecognisedCell, cols, cols)
+		for col := range cells[row] {
+			digit, conf := cellDigit(recognitions[row][col].DigitProbabilities, cols)
+			if notEmpty[row][col] && digit > 0 {
+				recognised[row][col] = recogniseCell(features[row][col], digit, conf)
+			} else if pencil := pencilRows[row][col]; pencil >= 0 {
+				recognised[row][col].PencilMarks = pencilMarks(recognitions[pencil], pencilMarked[pencil-rows])
+			}
 			fn := fmt.Sprintf("%v_%v-%v-%.2f.png", row, col, digit, conf)
 			saveImage(&cells[row][col], fn)
 		}
@@ -1,7 +1,9 @@
 package sudoku
 
 import (
+	"image"
 	"math"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,7 +70,45 @@ func TestPointSimilarities(t *testing.T) {
 	}
 
 	for _, tt := range examples {
-		fit, matchedPoints := pointSimilarities(tt.idealPoints, tt.closestPoints)
+		fit, matchedPoints := scaledPointSimilarities(tt.idealPoints, tt.closestPoints, 9)
+		assert.InDelta(t, tt.fit, fit, 0.0001)
+		assert.EqualValues(t, tt.expectedMatches, matchedPoints)
+	}
+}
+
+func TestScaledPointSimilarities(t *testing.T) {
+	var examples = []struct {
+		closestPoints   []float64
+		idealPoints     []float64
+		intervals       int
+		expectedMatches []float64
+		fit             float64
+	}{
+		{
+			closestPoints:   preparePointDistances([]float64{2.5, 12, 21.5, 32.5}),
+			idealPoints:     []float64{2, 12, 22},
+			intervals:       2, // 2x2 grid
+			expectedMatches: []float64{2.5, 12, 21.5},
+			fit:             0.95,
+		},
+		{
+			closestPoints:   preparePointDistances([]float64{2.5, 12, 21.5, 32.5}),
+			idealPoints:     []float64{12, 22, 32},
+			intervals:       2,
+			expectedMatches: []float64{12, 21.5, 32.5},
+			fit:             0.925,
+		},
+		{
+			closestPoints:   preparePointDistances([]float64{2.5, 12, 21.5, 32.5}),
+			idealPoints:     []float64{2, 12, 22},
+			intervals:       9, // Intervals of 9x9 grid
+			expectedMatches: []float64{2.5, 12, 21.5},
+			fit:             0.9888,
+		},
+	}
+
+	for _, tt := range examples {
+		fit, matchedPoints := scaledPointSimilarities(tt.idealPoints, tt.closestPoints, tt.intervals)
 		assert.InDelta(t, tt.fit, fit, 0.0001)
 		assert.EqualValues(t, tt.expectedMatches, matchedPoints)
 	}
@@ -159,7 +199,7 @@ func TestLinearDistances(t *testing.T) {
 		},
 	}
 
-	matches := linearDistances(lines, dividerLine)
+	matches := linearDistances(lines, dividerLine, 10)
 	assert.Len(t, matches, len(expectedScoredLines))
 
 	for i, match := range matches {
@@ -237,9 +277,146 @@ func TestPossibleGrids(t *testing.T) {
 		Score: 0.98046 * 0.98046,
 	}
 
-	grids := possibleGrids(linesH, linesV)
+	grids := possibleGrids(linesH, linesV, 10, 3)
 	assert.Len(t, grids, 9)
 	assert.EqualValues(t, grids[0].Horizontal, firstExpectedGrid.Horizontal)
 	assert.EqualValues(t, grids[0].Vertical, firstExpectedGrid.Vertical)
 	assert.InDelta(t, grids[0].Score, firstExpectedGrid.Score, 0.0001)
 }
+
+func TestGridFromCorners(t *testing.T) {
+	corners := [4]pointF{
+		pointF{10, 20},
+		pointF{100, 20},
+		pointF{100, 110},
+		pointF{10, 110},
+	}
+
+	grid := gridFromCorners(corners, 9)
+	assert.Len(t, grid.Horizontal, 10)
+	assert.Len(t, grid.Vertical, 10)
+
+	for i := 0; i < 10; i++ {
+		assert.InDelta(t, math.Pi/2, grid.Horizontal[i].Theta, 0.0001)
+		assert.EqualValues(t, 20+10*i, grid.Horizontal[i].Distance)
+		assert.InDelta(t, 0, grid.Vertical[i].Theta, 0.0001)
+		assert.EqualValues(t, 10+10*i, grid.Vertical[i].Distance)
+	}
+
+	_, topLeft := intersection(grid.Horizontal[0], grid.Vertical[0])
+	_, bottomRight := intersection(grid.Horizontal[9], grid.Vertical[9])
+	assert.Equal(t, image.Point{10, 20}, topLeft)
+	assert.Equal(t, image.Point{100, 110}, bottomRight)
+}
+
+func squareGrid(x, y, cell int) lineGrid {
+	grid := lineGrid{
+		Horizontal: make([]polarLine, 10, 10),
+		Vertical:   make([]polarLine, 10, 10),
+	}
+	for i := 0; i < 10; i++ {
+		grid.Horizontal[i] = polarLine{Theta: math.Pi / 2, Distance: float64(y + i*cell)}
+		grid.Vertical[i] = polarLine{Theta: 0, Distance: float64(x + i*cell)}
+	}
+	return grid
+}
+
+func TestGridsOverlap(t *testing.T) {
+	var examples = []struct {
+		a       lineGrid
+		b       lineGrid
+		overlap bool
+	}{
+		{squareGrid(10, 10, 10), squareGrid(10, 10, 10), true},
+		{squareGrid(10, 10, 10), squareGrid(20, 10, 10), true},   // Shifted by a cell
+		{squareGrid(10, 10, 10), squareGrid(50, 50, 10), true},   // Covers the same area
+		{squareGrid(10, 10, 10), squareGrid(200, 10, 10), false}, // Side by side, shares horizontal lines
+		{squareGrid(10, 10, 10), squareGrid(10, 200, 10), false}, // One under another
+	}
+
+	for i, tt := range examples {
+		assert.Equal(t, tt.overlap, gridsOverlap(tt.a, tt.b), "Example %v", i)
+		assert.Equal(t, tt.overlap, gridsOverlap(tt.b, tt.a), "Example %v", i)
+	}
+}
+
+func TestLineGridByPosition(t *testing.T) {
+	grids := []lineGrid{
+		squareGrid(300, 330, 20),
+		squareGrid(300, 10, 20),
+		squareGrid(10, 350, 20),
+		squareGrid(10, 20, 20),
+	}
+
+	sort.Sort(lineGridByPosition(grids))
+
+	expected := []image.Point{{10, 20}, {300, 10}, {10, 350}, {300, 330}}
+	for i, grid := range grids {
+		assert.Equal(t, expected[i], grid.Corners()[0])
+	}
+}
+
+func TestEvaluateGrids(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 200))
+	good := squareGrid(100, 100, 10)
+	good.Score = 0.5
+	bad := squareGrid(10, 10, 10)
+	bad.Score = 1
+
+	for _, line := range good.Horizontal {
+		for x := 100; x <= 190; x++ {
+			img.Pix[img.PixOffset(x, int(line.Distance))] = 255
+		}
+	}
+	for _, line := range good.Vertical {
+		for y := 100; y <= 190; y++ {
+			img.Pix[img.PixOffset(int(line.Distance), y)] = 255
+		}
+	}
+
+	// Order and scores are kept, so the same grid is picked as the best one
+	grids := evaluateGrids(*img, []lineGrid{good, bad})
+	assert.Equal(t, bad.Horizontal, grids[0].Horizontal)
+	assert.Equal(t, 1.0, grids[0].Score)
+	assert.InDelta(t, 0, grids[0].Coverage, 0.01)
+	assert.Equal(t, 0.5, grids[1].Score)
+	assert.InDelta(t, 1, grids[1].Coverage, 0.02)
+
+	sort.Stable(lineGridByCoverage(grids))
+	assert.Equal(t, good.Horizontal, grids[0].Horizontal)
+}
+
+func TestCandidateGridsBest(t *testing.T) {
+	s := &lineSudoku{PreProcessed: *drawSudokuGrid(), Size: Grid9x9}
+	grids := s.candidateGrids(Options{}, 3)
+	assert.NotEmpty(t, grids)
+
+	// Grid drawn on the image, as picked by NewSudoku
+	corners := grids[0].Corners()
+	expected := [4]image.Point{{20, 20}, {200, 20}, {200, 200}, {20, 200}}
+	for i, corner := range corners {
+		assert.InDelta(t, expected[i].X, corner.X, 2)
+		assert.InDelta(t, expected[i].Y, corner.Y, 2)
+	}
+}
+
+func TestLinearDistancesSmallGrid(t *testing.T) {
+	lines := []polarLine{
+		polarLine{Theta: 0, Distance: 5}, // odd
+		polarLine{Theta: 0, Distance: 10},
+		polarLine{Theta: 0, Distance: 30},
+		polarLine{Theta: 0, Distance: 50},
+		polarLine{Theta: 0, Distance: 70},
+		polarLine{Theta: 0, Distance: 90},
+		polarLine{Theta: 0, Distance: 110},
+		polarLine{Theta: 0, Distance: 130},
+	}
+	dividerLine := polarLine{Theta: math.Pi / 2, Distance: 0}
+
+	matches := linearDistances(lines, dividerLine, 7)
+	assert.Len(t, matches, 1)
+	assert.InDelta(t, 1.0, matches[0].Score, 0.0001)
+	assert.EqualValues(t, lines[1:], matches[0].Lines)
+
+	assert.Len(t, linearDistances(lines, dividerLine, 10), 0)
+}
@@ -0,0 +1,132 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/mrfuxi/sudoku/digits"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrokeWidths(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 10, 10))
+	fillRect(mask, image.Rect(2, 1, 5, 9), 255) // Vertical stroke 3px wide
+
+	widths := strokeWidths(*mask)
+	assert.Len(t, widths, 6) // Middle of the stroke, without its ends
+	for _, w := range widths {
+		assert.Equal(t, 3.0, w)
+	}
+
+	dist := distanceTransform(*mask)
+	assert.Equal(t, []float64{0, 0, 1, 2, 1, 0}, dist[4*10:4*10+6])
+}
+
+// Digit "7" drawn with given ink on drawCell
+func drawSeven(ink uint8, widths []int) *image.Gray {
+	img := drawCell()
+	fillRect(img, image.Rect(14, 12, 40, 12+widths[0]), ink)
+	for y := 12; y < 44; y++ {
+		width := widths[y%len(widths)]
+		fillRect(img, image.Rect(36, y, 36+width, y+1), ink)
+	}
+	return img
+}
+
+// Measures digit of the cell the way extractCells does
+func measureCell(cell image.Gray) (WritingFeatures, bool) {
+	digit, box, ok := centralComponentBox(inkImage(cell, otsuValue(cell)))
+	if !ok {
+		return WritingFeatures{}, false
+	}
+	return measureWriting(cell, digit, box), true
+}
+
+func TestMeasureWriting(t *testing.T) {
+	printed, ok := measureCell(*drawSeven(20, []int{4}))
+	assert.True(t, ok)
+	assert.InDelta(t, 32.0/56, printed.Height, 0.001)
+	assert.InDelta(t, 1.0/56, printed.Offset, 0.001) // Box is 1px left of the centre
+	assert.Equal(t, 0.0, printed.HeightDeviation)
+
+	pencil, ok := measureCell(*drawSeven(110, []int{2, 3, 5, 2, 1, 4}))
+	assert.True(t, ok)
+	assert.True(t, pencil.StrokeVariation > printed.StrokeVariation)
+
+	// Written in the corner of the cell
+	shifted := drawCell()
+	fillRect(shifted, image.Rect(30, 26, 46, 30), 20)
+	fillRect(shifted, image.Rect(42, 26, 46, 50), 20)
+	corner, ok := measureCell(*shifted)
+	assert.True(t, ok)
+	assert.InDelta(t, 0.25, corner.Offset, 0.01)
+
+	printed.HeightDeviation = 0
+	printedCell := recogniseCell(printed, 7, 0.99)
+	assert.Equal(t, CellPrinted, printedCell.Kind)
+	assert.Equal(t, 7, printedCell.Digit)
+	assert.Equal(t, printed, printedCell.Writing)
+	corner.HeightDeviation = 0.3
+	cornerCell := recogniseCell(corner, 7, 0.8)
+	assert.Equal(t, CellHandwritten, cornerCell.Kind)
+	assert.True(t, cornerCell.Handwritten > printedCell.Handwritten)
+
+	_, ok = measureCell(*drawCell())
+	assert.False(t, ok)
+}
+
+func TestSetHeightDeviation(t *testing.T) {
+	features := [][]WritingFeatures{
+		{{Height: 0.5}, {Height: 0.6}, {}},
+		{{Height: 0.5}, {Height: 0.4}, {Height: 0.5}},
+	}
+	notEmpty := [][]bool{{true, true, false}, {true, true, true}}
+
+	setHeightDeviation(features, notEmpty)
+	assert.InDelta(t, 0, features[0][0].HeightDeviation, 1e-9)
+	assert.InDelta(t, 0.2, features[0][1].HeightDeviation, 1e-9)
+	assert.InDelta(t, 0.2, features[1][1].HeightDeviation, 1e-9)
+	assert.Equal(t, 0.0, features[0][2].HeightDeviation)
+}
+
+func TestHandwritten(t *testing.T) {
+	printed := WritingFeatures{StrokeVariation: 0.15, Height: 0.55, Offset: 0.02}
+	assert.True(t, handwritten(printed, 0.99) < 0.5)
+
+	// Every feature of handwriting makes the digit more likely handwritten
+	more := []func(f *WritingFeatures){
+		func(f *WritingFeatures) { f.StrokeVariation += 0.1 },
+		func(f *WritingFeatures) { f.Height += 0.1 },
+		func(f *WritingFeatures) { f.HeightDeviation += 0.1 },
+		func(f *WritingFeatures) { f.Offset += 0.05 },
+	}
+	for _, change := range more {
+		features := printed
+		change(&features)
+		assert.True(t, handwritten(features, 0.99) > handwritten(printed, 0.99))
+	}
+	assert.True(t, handwritten(printed, 0.7) > handwritten(printed, 0.99))
+
+	assert.Equal(t, "handwritten", CellHandwritten.String())
+	assert.Equal(t, "empty", CellEmpty.String())
+}
+
+func TestCellDigit(t *testing.T) {
+	testCases := []struct {
+		probabilities digits.Probabilities
+		cells         int
+		digit         int
+		confidence    float64
+	}{
+		{digits.Probabilities{0, 0.1, 0, 0, 0, 0, 0, 0.9, 0, 0}, 9, 7, 0.9},
+		{digits.Probabilities{0.8, 0, 0, 0.15, 0, 0, 0, 0.05, 0, 0}, 9, 3, 0.15}, // Zero is not a digit
+		{digits.Probabilities{0, 0.1, 0, 0, 0, 0, 0, 0.9, 0, 0}, 4, 1, 0.1},      // Out of 4x4 grid
+		{digits.Probabilities{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 9, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		digit, confidence := cellDigit(tc.probabilities, tc.cells)
+		assert.Equal(t, tc.digit, digit)
+		assert.Equal(t, tc.confidence, confidence)
+	}
+}
@@ -0,0 +1,229 @@
+package sudoku
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/gonum/matrix"
+	"github.com/gonum/matrix/mat64"
+)
+
+const (
+	ransacIterations = 200
+	ransacSeed       = 1 // Fixed seed, so the same image always gives the same result
+)
+
+// Hartley normalisation: moves centroid of points to the origin and scales them,
+// so average distance from the origin is sqrt(2).
+// Returns normalised points, scale and centroid.
+func normalisePoints(points []pointF) ([]pointF, float64, pointF) {
+	var centroid pointF
+	for _, pt := range points {
+		centroid.X += pt.X / float64(len(points))
+		centroid.Y += pt.Y / float64(len(points))
+	}
+
+	meanDist := 0.0
+	for _, pt := range points {
+		meanDist += math.Hypot(pt.X-centroid.X, pt.Y-centroid.Y) / float64(len(points))
+	}
+
+	scale := 1.0
+	if meanDist > 0 {
+		scale = math.Sqrt2 / meanDist
+	}
+
+	normalised := make([]pointF, len(points), len(points))
+	for i, pt := range points {
+		normalised[i] = pointF{(pt.X - centroid.X) * scale, (pt.Y - centroid.Y) * scale}
+	}
+	return normalised, scale, centroid
+}
+
+// Direct linear transformation: least squares homography mapping src points to dst.
+// At least 4 pairs are needed, returns false when points are degenerate.
+func estimateHomography(src, dst []pointF) (*perspectiveTrasnformation, bool) {
+	if len(src) < 4 || len(src) != len(dst) {
+		return nil, false
+	}
+
+	srcN, srcScale, srcCentroid := normalisePoints(src)
+	dstN, dstScale, dstCentroid := normalisePoints(dst)
+
+	// With 4 points there are only 8 equations, extra zero row keeps V complete
+	rows := 2 * len(src)
+	if rows < 9 {
+		rows = 9
+	}
+	A := mat64.NewDense(rows, 9, nil)
+	for i := range srcN {
+		x, y := srcN[i].X, srcN[i].Y
+		u, v := dstN[i].X, dstN[i].Y
+
+		A.Set(2*i, 0, -x)
+		A.Set(2*i, 1, -y)
+		A.Set(2*i, 2, -1)
+		A.Set(2*i, 6, u*x)
+		A.Set(2*i, 7, u*y)
+		A.Set(2*i, 8, u)
+
+		A.Set(2*i+1, 3, -x)
+		A.Set(2*i+1, 4, -y)
+		A.Set(2*i+1, 5, -1)
+		A.Set(2*i+1, 6, v*x)
+		A.Set(2*i+1, 7, v*y)
+		A.Set(2*i+1, 8, v)
+	}
+
+	var svd mat64.SVD
+	if ok := svd.Factorize(A, matrix.SVDFull); !ok {
+		return nil, false
+	}
+	values := svd.Values(nil)
+	if values[0] == 0 || values[7]/values[0] < 1e-10 {
+		return nil, false // More than one solution
+	}
+
+	var V mat64.Dense
+	V.VFromSVD(&svd)
+
+	// Solution is the singular vector of the smallest singular value
+	var h [9]float64
+	for i := range h {
+		h[i] = V.At(i, 8)
+	}
+
+	// Undo normalisation: H = inv(Tdst) * Hn * Tsrc
+	Hn := mat64.NewDense(3, 3, h[:])
+	Tsrc := mat64.NewDense(3, 3, []float64{
+		srcScale, 0, -srcScale * srcCentroid.X,
+		0, srcScale, -srcScale * srcCentroid.Y,
+		0, 0, 1,
+	})
+	TdstInv := mat64.NewDense(3, 3, []float64{
+		1 / dstScale, 0, dstCentroid.X,
+		0, 1 / dstScale, dstCentroid.Y,
+		0, 0, 1,
+	})
+
+	var tmp, H mat64.Dense
+	tmp.Mul(Hn, Tsrc)
+	H.Mul(TdstInv, &tmp)
+
+	norm := H.At(2, 2)
+	if math.Abs(norm) < 1e-12 {
+		norm = 1
+	}
+
+	return &perspectiveTrasnformation{
+		H11: H.At(0, 0) / norm,
+		H12: H.At(0, 1) / norm,
+		H13: H.At(0, 2) / norm,
+		H21: H.At(1, 0) / norm,
+		H22: H.At(1, 1) / norm,
+		H23: H.At(1, 2) / norm,
+		H31: H.At(2, 0) / norm,
+		H32: H.At(2, 1) / norm,
+		H33: H.At(2, 2) / norm,
+	}, true
+}
+
+// Distance between projected src point and its dst pair
+func reprojectionError(proj *perspectiveTrasnformation, src, dst pointF) float64 {
+	x, y := proj.Project(src.X, src.Y)
+	return math.Hypot(x-dst.X, y-dst.Y)
+}
+
+// Checks that no 3 of 4 points lie on one line
+func generalPosition(pts [4]pointF) bool {
+	for i := 0; i < 4; i++ {
+		a, b, c := pts[i], pts[(i+1)%4], pts[(i+2)%4]
+		cross := (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+		if math.Abs(cross) < 1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+// Estimates homography robust to outliers with RANSAC.
+// Pairs with reprojection error above threshold (in dst units) are outliers.
+// Final homography is fitted to all inliers, which are also returned.
+func ransacHomography(src, dst []pointF, threshold float64) (*perspectiveTrasnformation, []bool, bool) {
+	if len(src) < 4 || len(src) != len(dst) {
+		return nil, nil, false
+	}
+
+	rnd := rand.New(rand.NewSource(ransacSeed))
+	var best []bool
+	bestCount, bestError := 0, 0.0
+
+	for i := 0; i < ransacIterations; i++ {
+		sample := rnd.Perm(len(src))[:4]
+		var sampleSrc, sampleDst [4]pointF
+		for j, idx := range sample {
+			sampleSrc[j], sampleDst[j] = src[idx], dst[idx]
+		}
+		if !generalPosition(sampleSrc) || !generalPosition(sampleDst) {
+			continue
+		}
+
+		proj, ok := estimateHomography(sampleSrc[:], sampleDst[:])
+		if !ok {
+			continue
+		}
+
+		inliers := make([]bool, len(src), len(src))
+		count, totalError := 0, 0.0
+		for j := range src {
+			if e := reprojectionError(proj, src[j], dst[j]); e <= threshold {
+				inliers[j] = true
+				count++
+				totalError += e
+			}
+		}
+
+		if count > bestCount || (count == bestCount && totalError < bestError) {
+			best, bestCount, bestError = inliers, count, totalError
+		}
+		if bestCount == len(src) && len(src) == 4 {
+			break // Nothing more to find
+		}
+	}
+
+	if bestCount < 4 {
+		return nil, nil, false
+	}
+
+	var inlierSrc, inlierDst []pointF
+	for i, inlier := range best {
+		if inlier {
+			inlierSrc = append(inlierSrc, src[i])
+			inlierDst = append(inlierDst, dst[i])
+		}
+	}
+
+	proj, ok := estimateHomography(inlierSrc, inlierDst)
+	return proj, best, ok
+}
+
+// Homography flattening the grid into width x height image,
+// estimated from all trusted intersections.
+func meshHomography(corners [][]Corner, width, height float64) (*perspectiveTrasnformation, bool) {
+	rows, cols := len(corners)-1, len(corners[0])-1
+	cellW, cellH := width/float64(cols), height/float64(rows)
+
+	var src, dst []pointF
+	for row := range corners {
+		for col, corner := range corners[row] {
+			if corner.Confidence < minCornerConfidence {
+				continue
+			}
+			src = append(src, pointF{corner.X, corner.Y})
+			dst = append(dst, pointF{float64(col) * cellW, float64(row) * cellH})
+		}
+	}
+
+	proj, _, ok := ransacHomography(src, dst, math.Min(cellW, cellH)/4)
+	return proj, ok
+}
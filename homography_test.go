@@ -0,0 +1,109 @@
+package sudoku
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalisePoints(t *testing.T) {
+	points := []pointF{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	normalised, scale, centroid := normalisePoints(points)
+
+	assert.Equal(t, pointF{5, 5}, centroid)
+	assert.InDelta(t, math.Sqrt2/math.Sqrt(50), scale, 0.0001)
+	for _, pt := range normalised {
+		assert.InDelta(t, math.Sqrt2, math.Hypot(pt.X, pt.Y), 0.0001)
+	}
+}
+
+func TestEstimateHomography(t *testing.T) {
+	src := []pointF{{54, 64}, {368, 52}, {391, 391}, {27, 387}}
+	dst := []pointF{{0, 0}, {420, 0}, {420, 420}, {0, 420}}
+
+	proj, ok := estimateHomography(src, dst)
+	assert.True(t, ok)
+
+	// Same as exact solution from 4 points
+	exact := newPerspective([4]pointF{src[0], src[1], src[2], src[3]}, [4]pointF{dst[0], dst[1], dst[2], dst[3]})
+	for _, pt := range []pointF{{54, 64}, {200, 200}, {100, 300}} {
+		x, y := proj.Project(pt.X, pt.Y)
+		expectedX, expectedY := exact.Project(pt.X, pt.Y)
+		assert.InDelta(t, expectedX, x, 0.001)
+		assert.InDelta(t, expectedY, y, 0.001)
+	}
+
+	_, ok = estimateHomography(src[:3], dst[:3])
+	assert.False(t, ok)
+
+	// All points on one line
+	line := []pointF{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {4, 4}}
+	_, ok = estimateHomography(line, line)
+	assert.False(t, ok)
+}
+
+// Points of 10x10 grid projected with known homography
+func projectedGrid(proj *perspectiveTrasnformation) ([]pointF, []pointF) {
+	var src, dst []pointF
+	for row := 0; row < 10; row++ {
+		for col := 0; col < 10; col++ {
+			flat := pointF{float64(col * 10), float64(row * 10)}
+			x, y := proj.Project(flat.X, flat.Y)
+			src = append(src, pointF{x, y})
+			dst = append(dst, flat)
+		}
+	}
+	return src, dst
+}
+
+func TestRansacHomography(t *testing.T) {
+	known := newPerspective(
+		[4]pointF{{0, 0}, {90, 0}, {90, 90}, {0, 90}},
+		[4]pointF{{54, 64}, {368, 52}, {391, 391}, {27, 387}},
+	)
+	src, dst := projectedGrid(known)
+
+	// Noise everywhere, one intersection totally off
+	for i := range src {
+		src[i].X += float64(i%3-1) * 0.3
+	}
+	src[11] = pointF{300, 100}
+
+	proj, inliers, ok := ransacHomography(src, dst, 2)
+	assert.True(t, ok)
+	assert.False(t, inliers[11])
+	for i := range inliers {
+		if i != 11 {
+			assert.True(t, inliers[i], "Point %v", i)
+		}
+	}
+
+	x, y := proj.Project(src[55].X, src[55].Y)
+	assert.InDelta(t, 50, x, 0.2)
+	assert.InDelta(t, 50, y, 0.2)
+
+	_, _, ok = ransacHomography(src[:3], dst[:3], 2)
+	assert.False(t, ok)
+}
+
+func TestMeshHomography(t *testing.T) {
+	corners := make([][]Corner, 3, 3)
+	for row := range corners {
+		corners[row] = make([]Corner, 3, 3)
+		for col := range corners[row] {
+			corners[row][col] = Corner{X: float64(10 + col*20), Y: float64(10 + row*20), Confidence: 1}
+		}
+	}
+	// Bad corner
+	corners[2][2] = Corner{X: 60, Y: 45, Confidence: 1}
+
+	proj, ok := meshHomography(corners, 100, 100)
+	assert.True(t, ok)
+	x, y := proj.Project(30, 30)
+	assert.InDelta(t, 50, x, 0.001)
+	assert.InDelta(t, 50, y, 0.001)
+	x, y = proj.Project(50, 50)
+	assert.InDelta(t, 100, x, 0.001)
+	assert.InDelta(t, 100, y, 0.001)
+}
@@ -12,16 +12,26 @@ import (
 
 type polarLine struct {
 	Theta    float64
-	Distance int
+	Distance float64 // Whole pixels when found by Hough transform
 	Count    uint64
 }
 
 func (l polarLine) String() string {
-	return fmt.Sprintf("Line{Theta: %f, Distance: %d, Count: %d}", l.Theta, l.Distance, l.Count)
+	return fmt.Sprintf("Line{Theta: %f, Distance: %g, Count: %d}", l.Theta, l.Distance, l.Count)
 }
 
 func (l polarLine) HashKey() string {
-	return fmt.Sprintf("%0.8f:%d", l.Theta, l.Distance)
+	return fmt.Sprintf("%0.8f:%g", l.Theta, l.Distance)
+}
+
+// Scaled maps line found on image resized by 1/scale back to original image.
+// Pixel x on resized image covers original pixels [x*scale, (x+1)*scale),
+// so its centre is moved by (scale-1)/2 in both directions.
+// Distance is not rounded, so the line stays where it was found.
+func (l polarLine) Scaled(scale float64) polarLine {
+	shift := (scale - 1) / 2 * (math.Cos(l.Theta) + math.Sin(l.Theta))
+	l.Distance = l.Distance*scale + shift
+	return l
 }
 
 type polarLineHash []polarLine
@@ -58,6 +68,18 @@ func generateThetas(start, end, step float64) (thetas []float64) {
 }
 
 func houghLines(src image.Gray, thetas []float64, threshold uint64, limit int) []polarLine {
+	return orientedHoughLines(src, nil, 0, thetas, threshold, limit)
+}
+
+// Angular distance between two line normals, lines are the same for theta and theta+Pi
+func normalAngleDistance(a, b float64) float64 {
+	diff := math.Mod(math.Abs(a-b), math.Pi)
+	return math.Min(diff, math.Pi-diff)
+}
+
+// orientedHoughLines works as houghLines but if gradient directions are given
+// every pixel votes only for angles within window (radians) from its own direction
+func orientedHoughLines(src image.Gray, directions []float64, window float64, thetas []float64, threshold uint64, limit int) []polarLine {
 	if thetas == nil {
 		thetas = generateThetas(-math.Pi/2, math.Pi/2, math.Pi/180.0)
 	}
@@ -82,12 +104,15 @@ func houghLines(src image.Gray, thetas []float64, threshold uint64, limit int) [
 		wg.Add(1)
 		go func(y int) {
 			for x := 0; x < maxX; x++ {
-				val := src.Pix[src.PixOffset(x, y)]
-				if val == 0 {
+				pos := src.PixOffset(x, y)
+				if src.Pix[pos] == 0 {
 					continue
 				}
 
 				for i := range thetas {
+					if directions != nil && normalAngleDistance(thetas[i], directions[pos]) > window {
+						continue
+					}
 					r := float64(x)*cos[i] + float64(y)*sin[i]
 					iry := int(r + offset)
 					atomic.AddUint64(&hAcc[iry][i], 1)
@@ -114,7 +139,7 @@ func houghLines(src image.Gray, thetas []float64, threshold uint64, limit int) [
 
 			line := polarLine{
 				Theta:    thetas[j] + thetaOffset,
-				Distance: r,
+				Distance: float64(r),
 				Count:    count,
 			}
 			hash := line.HashKey()
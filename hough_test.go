@@ -3,6 +3,7 @@ package sudoku
 import (
 	"image"
 	"image/color"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -62,3 +63,42 @@ func TestHoughLines(t *testing.T) {
 		}
 	}
 }
+
+func TestOrientedHoughLines(t *testing.T) {
+	timg := image.NewGray(image.Rect(0, 0, 100, 100))
+	directions := make([]float64, len(timg.Pix), len(timg.Pix))
+	for y := 0; y < 100; y++ {
+		pos := timg.PixOffset(10, y)
+		timg.Pix[pos] = 255
+		directions[pos] = math.Pi
+	}
+
+	lines := orientedHoughLines(*timg, directions, math.Pi/18, nil, 0, 0)
+	for _, line := range lines {
+		assert.True(t, normalAngleDistance(line.Theta, 0) <= math.Pi/18, "%v", line)
+	}
+
+	assert.EqualValues(t, 10, lines[0].Distance)
+	assert.EqualValues(t, 100, lines[0].Count)
+	assert.True(t, len(lines) < len(houghLines(*timg, nil, 0, 0)))
+}
+
+func TestPolarLineScaled(t *testing.T) {
+	var examples = []struct {
+		line     polarLine
+		scale    float64
+		expected polarLine
+	}{
+		{polarLine{Theta: 0, Distance: 10}, 1, polarLine{Theta: 0, Distance: 10}},
+		{polarLine{Theta: 0, Distance: 10}, 2, polarLine{Theta: 0, Distance: 20.5}},
+		{polarLine{Theta: math.Pi / 2, Distance: 10}, 3, polarLine{Theta: math.Pi / 2, Distance: 31}},
+		{polarLine{Theta: math.Pi / 4, Distance: 10}, 2, polarLine{Theta: math.Pi / 4, Distance: 20 + 0.5*math.Sqrt2}},
+		{polarLine{Theta: 0, Distance: 10}, 1.3, polarLine{Theta: 0, Distance: 13.15}}, // Not rounded
+	}
+
+	for _, tt := range examples {
+		scaled := tt.line.Scaled(tt.scale)
+		assert.InDelta(t, tt.expected.Distance, scaled.Distance, 0.0001, "%v scaled by %v", tt.line, tt.scale)
+		assert.Equal(t, tt.expected.Theta, scaled.Theta)
+	}
+}
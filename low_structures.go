@@ -63,7 +63,7 @@ func intersection(lineA, lineB polarLine) (bool, image.Point) {
 		math.Cos(lineB.Theta), math.Sin(lineB.Theta),
 	})
 	b := mat64.NewDense(2, 1, []float64{
-		float64(lineA.Distance), float64(lineB.Distance),
+		lineA.Distance, lineB.Distance,
 	})
 	x := mat64.NewDense(2, 1, nil)
 	err := x.Solve(A, b)
@@ -77,6 +77,27 @@ func intersection(lineA, lineB polarLine) (bool, image.Point) {
 	return ok, point
 }
 
+// Line in polar form passing through two points
+func lineThroughPoints(a, b pointF) polarLine {
+	theta := math.Atan2(b.X-a.X, a.Y-b.Y)
+	distance := a.X*math.Cos(theta) + a.Y*math.Sin(theta)
+	if distance < 0 {
+		theta += math.Pi
+		distance = -distance
+	}
+
+	// Keep angles in the same range as Hough transform does: [-Pi/2, 3Pi/2)
+	theta = math.Mod(theta+pi2, pi2)
+	if theta >= 3*math.Pi/2 {
+		theta -= pi2
+	}
+
+	return polarLine{
+		Theta:    theta,
+		Distance: math.Floor(distance + 0.5),
+	}
+}
+
 // duplicates: crosses in view at low angle
 func removeDuplicateLines(lines []polarLine, width, height int) []polarLine {
 	minDist := 3.0
@@ -97,7 +118,7 @@ func removeDuplicateLines(lines []polarLine, width, height int) []polarLine {
 				continue
 			}
 
-			if math.Abs(float64(lineA.Distance-lineB.Distance)) < minDist {
+			if math.Abs(lineA.Distance-lineB.Distance) < minDist {
 				toRemove[k] = true
 				continue
 			}
@@ -417,3 +417,24 @@ func TestPointsOnFragment(t *testing.T) {
 		assert.EqualValues(t, tt.points, points)
 	}
 }
+
+func TestLineThroughPoints(t *testing.T) {
+	var examples = []struct {
+		a    pointF
+		b    pointF
+		line polarLine
+	}{
+		{pointF{0, 10}, pointF{9, 10}, polarLine{Theta: math.Pi / 2, Distance: 10}},
+		{pointF{9, 10}, pointF{0, 10}, polarLine{Theta: math.Pi / 2, Distance: 10}},
+		{pointF{10, 0}, pointF{10, 9}, polarLine{Theta: 0, Distance: 10}},
+		{pointF{10, 9}, pointF{10, 0}, polarLine{Theta: 0, Distance: 10}},
+		{pointF{-10, 0}, pointF{-10, 9}, polarLine{Theta: math.Pi, Distance: 10}},
+		{pointF{0, 10}, pointF{10, 0}, polarLine{Theta: math.Pi / 4, Distance: 7}},
+	}
+
+	for _, tt := range examples {
+		line := lineThroughPoints(tt.a, tt.b)
+		assert.InDelta(t, tt.line.Theta, line.Theta, thetaDelta, "Line through %v and %v", tt.a, tt.b)
+		assert.EqualValues(t, tt.line.Distance, line.Distance, "Line through %v and %v", tt.a, tt.b)
+	}
+}
@@ -0,0 +1,251 @@
+package sudoku
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// Intersections with lower confidence are not trusted, predicted position is used instead
+const minCornerConfidence = 0.5
+
+// Corner is an intersection of grid lines found on the image
+type Corner struct {
+	X          float64 // Position on original image, with sub-pixel precision
+	Y          float64
+	Confidence float64 // 0-1, how much image around the point looks like crossing lines
+}
+
+// Direction along the line (perpendicular to its normal)
+func lineDirection(line polarLine) pointF {
+	return pointF{-math.Sin(line.Theta), math.Cos(line.Theta)}
+}
+
+// Response of cross-shaped template: number of set pixels on two arms
+// going through pt in given directions
+func crossResponse(src image.Gray, pt image.Point, dirA, dirB pointF, arm int) int {
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	response := 0
+	for _, dir := range [2]pointF{dirA, dirB} {
+		for k := -arm; k <= arm; k++ {
+			x := pt.X + int(math.Floor(float64(k)*dir.X+0.5))
+			y := pt.Y + int(math.Floor(float64(k)*dir.Y+0.5))
+			if x < 0 || x >= width || y < 0 || y >= height {
+				continue
+			}
+			if src.Pix[src.PixOffset(x, y)] != 0 {
+				response++
+			}
+		}
+	}
+	return response
+}
+
+// Finds place with the strongest cross response within radius from predicted point.
+// Ties are resolved in favour of points closer to predicted one.
+func searchIntersection(src image.Gray, predicted image.Point, dirA, dirB pointF, arm, radius int) (image.Point, int) {
+	best := predicted
+	bestResponse := -1
+	bestDist := 0
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			pt := predicted.Add(image.Point{dx, dy})
+			response := crossResponse(src, pt, dirA, dirB, arm)
+			dist := dx*dx + dy*dy
+			if response > bestResponse || (response == bestResponse && dist < bestDist) {
+				best, bestResponse, bestDist = pt, response, dist
+			}
+		}
+	}
+	return best, bestResponse
+}
+
+// Peak of parabola going through 3 equally spaced values, relative to the middle one
+func parabolaPeak(before, middle, after float64) float64 {
+	denominator := before - 2*middle + after
+	if denominator >= 0 {
+		return 0 // Flat or not a peak
+	}
+	return math.Max(-0.5, math.Min(0.5, (before-after)/(2*denominator)))
+}
+
+// Refines position of intersection with sub-pixel precision,
+// by fitting parabola to cross responses around it
+func refineSubPixel(src image.Gray, pt image.Point, dirA, dirB pointF, arm int) pointF {
+	response := func(dx, dy int) float64 {
+		return float64(crossResponse(src, pt.Add(image.Point{dx, dy}), dirA, dirB, arm))
+	}
+
+	middle := response(0, 0)
+	return pointF{
+		X: float64(pt.X) + parabolaPeak(response(-1, 0), middle, response(1, 0)),
+		Y: float64(pt.Y) + parabolaPeak(response(0, -1), middle, response(0, 1)),
+	}
+}
+
+// Locates every intersection of grid lines by looking for crossing lines
+// around position predicted by the grid.
+// When follow is set bigger area is searched, so bent grids can be followed.
+// Search starts in the centre of the grid and goes outwards, every intersection
+// is expected to be moved from position predicted by the lines in the same way as
+// its already located neighbours.
+// Intersections with low confidence stay where they were expected to be.
+// Result is indexed [row][col], rows follow horizontal lines.
+func locateIntersections(src image.Gray, grid lineGrid, follow bool) [][]Corner {
+	rows, cols := len(grid.Horizontal), len(grid.Vertical)
+	corners := grid.Corners()
+	cellSize := distanceBetweenPoints(corners[0], corners[2]) / math.Hypot(float64(rows-1), float64(cols-1))
+	arm := int(cellSize/2) + 1
+	radius := int(cellSize/8) + 1
+	if follow {
+		radius = int(cellSize/3) + 1
+	}
+
+	type gridIndex struct{ Row, Col int }
+	order := make([]gridIndex, 0, rows*cols)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			order = append(order, gridIndex{row, col})
+		}
+	}
+	centreRow, centreCol := float64(rows-1)/2, float64(cols-1)/2
+	sort.SliceStable(order, func(i, j int) bool {
+		di := math.Max(math.Abs(float64(order[i].Row)-centreRow), math.Abs(float64(order[i].Col)-centreCol))
+		dj := math.Max(math.Abs(float64(order[j].Row)-centreRow), math.Abs(float64(order[j].Col)-centreCol))
+		return di < dj
+	})
+
+	predicted := make([][]image.Point, rows, rows)
+	located := make([][]image.Point, rows, rows)
+	done := make([][]bool, rows, rows)
+	refined := make([][]Corner, rows, rows)
+	for row := range located {
+		predicted[row] = make([]image.Point, cols, cols)
+		located[row] = make([]image.Point, cols, cols)
+		done[row] = make([]bool, cols, cols)
+		refined[row] = make([]Corner, cols, cols)
+		for col := range predicted[row] {
+			_, predicted[row][col] = intersection(grid.Horizontal[row], grid.Vertical[col])
+		}
+	}
+
+	neighbours := []gridIndex{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	for _, idx := range order {
+		start := predicted[idx.Row][idx.Col]
+		if follow {
+			var shiftX, shiftY, count int
+			for _, n := range neighbours {
+				row, col := idx.Row+n.Row, idx.Col+n.Col
+				if row < 0 || row >= rows || col < 0 || col >= cols || !done[row][col] {
+					continue
+				}
+				shift := located[row][col].Sub(predicted[row][col])
+				shiftX += shift.X
+				shiftY += shift.Y
+				count++
+			}
+			if count > 0 {
+				start = start.Add(image.Point{shiftX / count, shiftY / count})
+			}
+		}
+
+		dirA := lineDirection(grid.Horizontal[idx.Row])
+		dirB := lineDirection(grid.Vertical[idx.Col])
+		best, response := searchIntersection(src, start, dirA, dirB, arm, radius)
+		confidence := float64(response) / float64(2*(2*arm+1))
+
+		position := newPointF(start)
+		if confidence >= minCornerConfidence {
+			located[idx.Row][idx.Col] = best
+			position = refineSubPixel(src, best, dirA, dirB, arm)
+		} else {
+			located[idx.Row][idx.Col] = start
+		}
+		done[idx.Row][idx.Col] = true
+		refined[idx.Row][idx.Col] = Corner{X: position.X, Y: position.Y, Confidence: confidence}
+	}
+	return refined
+}
+
+// Maps corners found on image resized by 1/scale back to original image
+func scaleCorners(corners [][]Corner, scale float64) [][]Corner {
+	shift := (scale - 1) / 2
+	scaled := make([][]Corner, len(corners), len(corners))
+	for row := range corners {
+		scaled[row] = make([]Corner, len(corners[row]), len(corners[row]))
+		for col, corner := range corners[row] {
+			scaled[row][col] = Corner{
+				X:          corner.X*scale + shift,
+				Y:          corner.Y*scale + shift,
+				Confidence: corner.Confidence,
+			}
+		}
+	}
+	return scaled
+}
+
+// Positions of corners, indexed [row][col]
+func cornerPoints(corners [][]Corner) [][]pointF {
+	points := make([][]pointF, len(corners), len(corners))
+	for row := range corners {
+		points[row] = make([]pointF, len(corners[row]), len(corners[row]))
+		for col, corner := range corners[row] {
+			points[row][col] = pointF{corner.X, corner.Y}
+		}
+	}
+	return points
+}
+
+// Corners of a cell: top-left, top-right, bottom-right, bottom-left
+func cellCorners(mesh [][]pointF, row, col int) [4]pointF {
+	return [4]pointF{
+		mesh[row][col],
+		mesh[row][col+1],
+		mesh[row+1][col+1],
+		mesh[row+1][col],
+	}
+}
+
+// Line fragments between neighbouring points of the mesh
+func meshFragments(mesh [][]pointF) []lineFragment {
+	var fragments []lineFragment
+	for row := range mesh {
+		for col := range mesh[row] {
+			pt := image.Point{int(mesh[row][col].X + 0.5), int(mesh[row][col].Y + 0.5)}
+			if col+1 < len(mesh[row]) {
+				next := mesh[row][col+1]
+				fragments = append(fragments, lineFragment{pt, image.Point{int(next.X + 0.5), int(next.Y + 0.5)}})
+			}
+			if row+1 < len(mesh) {
+				next := mesh[row+1][col]
+				fragments = append(fragments, lineFragment{pt, image.Point{int(next.X + 0.5), int(next.Y + 0.5)}})
+			}
+		}
+	}
+	return fragments
+}
+
+// Flattens the grid by warping every cell from its own corners into destination image
+func warpMesh(src image.Image, dst draw.Image, mesh [][]pointF) {
+	rows, cols := len(mesh)-1, len(mesh[0])-1
+	bounds := dst.Bounds()
+	cellW := float64(bounds.Dx()) / float64(cols)
+	cellH := float64(bounds.Dy()) / float64(rows)
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			x0, y0 := float64(bounds.Min.X)+float64(col)*cellW, float64(bounds.Min.Y)+float64(row)*cellH
+			x1, y1 := x0+cellW, y0+cellH
+			block := [4]pointF{
+				pointF{x0, y0},
+				pointF{x1, y0},
+				pointF{x1, y1},
+				pointF{x0, y1},
+			}
+
+			proj := newPerspective(cellCorners(mesh, row, col), block)
+			proj.warpImage(src, dst, image.Rect(int(x0), int(y0), int(x1), int(y1)))
+		}
+	}
+}
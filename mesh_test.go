@@ -0,0 +1,122 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossResponse(t *testing.T) {
+	img := drawSudokuGrid()
+	horizontal, vertical := pointF{1, 0}, pointF{0, 1}
+
+	assert.Equal(t, 22, crossResponse(*img, image.Point{40, 40}, horizontal, vertical, 5))
+	assert.Equal(t, 12, crossResponse(*img, image.Point{40, 45}, horizontal, vertical, 5))
+	assert.Equal(t, 2, crossResponse(*img, image.Point{45, 45}, horizontal, vertical, 5))
+	assert.Equal(t, 0, crossResponse(*img, image.Point{50, 50}, horizontal, vertical, 5))
+}
+
+func TestLocateIntersections(t *testing.T) {
+	// Bent grid: vertical lines lean to the right, up to 6px at the bottom
+	img := image.NewGray(image.Rect(0, 0, 260, 260))
+	bend := func(y int) int {
+		return (y - 20) / 30
+	}
+	for i := 0; i < 10; i++ {
+		pos := 20 + i*20
+		for p := 20; p <= 210; p++ {
+			img.Pix[img.PixOffset(p, pos)] = 255
+			img.Pix[img.PixOffset(pos+bend(p), p)] = 255
+		}
+	}
+
+	grid := squareGrid(20, 20, 20)
+	mesh := locateIntersections(*img, grid, true)
+
+	assert.Len(t, mesh, 10)
+	for row := range mesh {
+		assert.Len(t, mesh[row], 10)
+		for col, corner := range mesh[row] {
+			y := 20 + row*20
+			// Where line bends both pixels are equally good
+			assert.InDelta(t, 20+col*20+bend(y), corner.X, 1, "Intersection %v, %v", row, col)
+			assert.InDelta(t, y, corner.Y, 0.5, "Intersection %v, %v", row, col)
+			assert.True(t, corner.Confidence >= minCornerConfidence, "Intersection %v, %v", row, col)
+		}
+	}
+}
+
+func TestLocateIntersectionsRefine(t *testing.T) {
+	img := drawSudokuGrid()
+	// Remove one intersection
+	for y := 88; y <= 112; y++ {
+		for x := 88; x <= 112; x++ {
+			img.Pix[img.PixOffset(x, y)] = 0
+		}
+	}
+
+	// Lines found by Hough are slightly off
+	grid := squareGrid(21, 19, 20)
+	corners := locateIntersections(*img, grid, false)
+
+	// Thick line covers 18-21, any place on it is as good
+	assert.InDelta(t, 20, corners[0][0].X, 2)
+	assert.InDelta(t, 20, corners[0][0].Y, 2)
+	assert.InDelta(t, 40, corners[1][1].X, 0.5)
+	assert.InDelta(t, 40, corners[1][1].Y, 0.5)
+	assert.InDelta(t, 60, corners[2][2].X, 0.5)
+	assert.InDelta(t, 40, corners[1][4].Y, 0.5)
+	assert.True(t, corners[2][2].Confidence > 0.9)
+
+	// Nothing to find, stays where it was expected
+	assert.True(t, corners[4][4].Confidence < minCornerConfidence)
+	assert.Equal(t, 101.0, corners[4][4].X)
+	assert.Equal(t, 99.0, corners[4][4].Y)
+}
+
+func TestParabolaPeak(t *testing.T) {
+	assert.InDelta(t, 0, parabolaPeak(1, 2, 1), 0.0001)
+	assert.InDelta(t, 0.5, parabolaPeak(1, 2, 2), 0.0001)
+	assert.InDelta(t, -1.0/6, parabolaPeak(2, 3, 1), 0.0001)
+	assert.InDelta(t, 0, parabolaPeak(2, 2, 2), 0.0001)
+	assert.InDelta(t, 0, parabolaPeak(3, 1, 3), 0.0001)
+}
+
+func TestCellCorners(t *testing.T) {
+	points := make([][]pointF, 10, 10)
+	for row := range points {
+		for col := 0; col < 10; col++ {
+			points[row] = append(points[row], pointF{float64(10 + col*5), float64(20 + row*5)})
+		}
+	}
+
+	corners := cellCorners(points, 1, 2)
+	assert.Equal(t, [4]pointF{{20, 25}, {25, 25}, {25, 30}, {20, 30}}, corners)
+
+	assert.Len(t, meshFragments(points), 2*9*10)
+}
+
+func TestScaleCorners(t *testing.T) {
+	corners := [][]Corner{{{0, 0, 0.5}, {10, 5, 1}}}
+	assert.Equal(t, corners, scaleCorners(corners, 1))
+	assert.Equal(t, [][]Corner{{{0.5, 0.5, 0.5}, {20.5, 10.5, 1}}}, scaleCorners(corners, 2))
+	assert.Equal(t, [][]pointF{{{0, 0}, {10, 5}}}, cornerPoints(corners))
+}
+
+func TestWarpMesh(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+	img.Pix[img.PixOffset(30, 10)] = 255
+
+	// 2x2 cells covering the whole image
+	mesh := [][]pointF{
+		{{0, 0}, {20, 0}, {40, 0}},
+		{{0, 20}, {20, 20}, {40, 20}},
+		{{0, 40}, {20, 40}, {40, 40}},
+	}
+
+	dst := image.NewGray(image.Rect(0, 0, 20, 80))
+	warpMesh(img, dst, mesh)
+	assert.Equal(t, uint8(255), dst.GrayAt(15, 20).Y)
+	assert.Equal(t, uint8(0), dst.GrayAt(5, 20).Y)
+}
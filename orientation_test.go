@@ -0,0 +1,107 @@
+package sudoku
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal EXIF segment with single orientation tag
+func exifSegment(orientation uint8, bigEndian bool) []byte {
+	tiff := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0, // Header, first IFD at 8
+		1, 0, // Number of entries
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, orientation, 0, 0, 0, // Orientation, SHORT, count 1
+		0, 0, 0, 0, // No next IFD
+	}
+	if bigEndian {
+		tiff = []byte{
+			'M', 'M', 0, 42, 0, 0, 0, 8,
+			0, 1,
+			0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0,
+			0, 0, 0, 0,
+		}
+	}
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	var examples = []struct {
+		data        []byte
+		orientation int
+	}{
+		{[]byte{}, 1},
+		{[]byte{0x89, 'P', 'N', 'G'}, 1},
+		{append([]byte{0xFF, 0xD8}, exifSegment(6, false)...), 6},
+		{append([]byte{0xFF, 0xD8}, exifSegment(8, true)...), 8},
+		{append([]byte{0xFF, 0xD8}, exifSegment(0, false)...), 1},
+		{append([]byte{0xFF, 0xD8}, exifSegment(9, false)...), 1},
+		{append([]byte{0xFF, 0xD8}, exifSegment(3, false)[:10]...), 1},
+	}
+
+	for _, tt := range examples {
+		assert.Equal(t, tt.orientation, exifOrientation(tt.data))
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 3x2 image:
+	// 1 2 3
+	// 4 5 6
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(src.Pix, []uint8{1, 2, 3, 4, 5, 6})
+
+	var examples = []struct {
+		orientation int
+		width       int
+		expected    []uint8
+	}{
+		{1, 3, []uint8{1, 2, 3, 4, 5, 6}},
+		{2, 3, []uint8{3, 2, 1, 6, 5, 4}},
+		{3, 3, []uint8{6, 5, 4, 3, 2, 1}},
+		{4, 3, []uint8{4, 5, 6, 1, 2, 3}},
+		{5, 2, []uint8{1, 4, 2, 5, 3, 6}},
+		{6, 2, []uint8{4, 1, 5, 2, 6, 3}},
+		{7, 2, []uint8{6, 3, 5, 2, 4, 1}},
+		{8, 2, []uint8{3, 6, 2, 5, 1, 4}},
+	}
+
+	for _, tt := range examples {
+		dst := applyOrientation(src, tt.orientation)
+		bounds := dst.Bounds()
+		assert.Equal(t, tt.width, bounds.Dx(), "Orientation %v", tt.orientation)
+
+		pixels := make([]uint8, 0, 6)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixels = append(pixels, color.GrayModel.Convert(dst.At(x, y)).(color.Gray).Y)
+			}
+		}
+		assert.EqualValues(t, tt.expected, pixels, "Orientation %v", tt.orientation)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 20)), nil)
+	encoded := buf.Bytes()
+
+	rotated := append([]byte{0xFF, 0xD8}, exifSegment(6, false)...)
+	rotated = append(rotated, encoded[2:]...)
+
+	img, format, err := DecodeImage(bytes.NewReader(rotated))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, 20, 40), img.Bounds())
+
+	img, _, err = DecodeImage(bytes.NewReader(encoded))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+}
@@ -0,0 +1,82 @@
+package sudoku
+
+import (
+	"image"
+	"sort"
+
+	"github.com/mrfuxi/sudoku/digits"
+)
+
+const (
+	pencilBorder        = 0.08 // Fraction of the cell on every side where grid lines are, not searched for marks
+	maxPencilMarkSize   = 0.35 // Ink taller than this fraction of the cell is a digit, not pencil marks
+	pencilLayoutBonus   = 0.05 // Added to probability of digit at its place of 3x3 layout (1 top-left ... 9 bottom-right), breaks near ties only
+	minPencilConfidence = 0.5  // Lowest probability of the network for a mark to be accepted
+)
+
+// Tells whether digit found by centralComponent is full size.
+// Small marks are pencil notes of candidates.
+func isFullDigit(digit image.Gray, cell image.Gray) bool {
+	return float64(digit.Bounds().Dy()) >= maxPencilMarkSize*float64(cell.Bounds().Dy())
+}
+
+// Splits the cell into 3x3 tiles of pencil marks and cleans every tile like a digit.
+// Tiles go row by row, false means there is no mark in the tile.
+func pencilTiles(cell image.Gray, threshold uint8) ([]image.Gray, []bool) {
+	bounds := cell.Bounds()
+	border := int(pencilBorder*float64(bounds.Dx()) + 0.5)
+	inner := bounds.Inset(border)
+
+	tiles := make([]image.Gray, 9, 9)
+	marked := make([]bool, 9, 9)
+	for i := 0; i < 9; i++ {
+		col, row := i%3, i/3
+		tile := image.Rect(
+			inner.Min.X+col*inner.Dx()/3,
+			inner.Min.Y+row*inner.Dy()/3,
+			inner.Min.X+(col+1)*inner.Dx()/3,
+			inner.Min.Y+(row+1)*inner.Dy()/3,
+		)
+		sub := cell.SubImage(tile).(*image.Gray)
+		tiles[i], marked[i] = cleanCell(*sub, threshold, false)
+	}
+	return tiles, marked
+}
+
+// Digit in the tile at given position (0-8) of 3x3 layout and its probability given
+// by the network. Players usually write candidate at its place in the layout,
+// so that digit wins when network can't tell between two digits.
+func pencilDigit(probabilities digits.Probabilities, position int) (int, float64) {
+	best, bestScore := 0, 0.0
+	for digit := 1; digit < len(probabilities) && digit <= 9; digit++ {
+		score := probabilities[digit]
+		if digit == position+1 {
+			score += pencilLayoutBonus
+		}
+		if probabilities[digit] > 0 && score > bestScore {
+			best, bestScore = digit, score
+		}
+	}
+	if best == 0 {
+		return 0, 0
+	}
+	return best, probabilities[best]
+}
+
+// Candidates from recognised tiles of one cell, in ascending order
+func pencilMarks(recognitions []digits.Recognition, marked []bool) []int {
+	var marks []int
+	seen := make(map[int]bool)
+	for i, recognition := range recognitions {
+		if !marked[i] {
+			continue
+		}
+		digit, confidence := pencilDigit(recognition.DigitProbabilities, i)
+		if confidence >= minPencilConfidence && !seen[digit] {
+			marks = append(marks, digit)
+			seen[digit] = true
+		}
+	}
+	sort.Ints(marks)
+	return marks
+}
@@ -0,0 +1,85 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/mrfuxi/sudoku/digits"
+	"github.com/stretchr/testify/assert"
+)
+
+// Cell with small marks in top-left and middle tiles of 3x3 layout
+func drawPencilMarks() *image.Gray {
+	img := drawCell()
+	fillRect(img, image.Rect(10, 8, 12, 17), 90)  // "1"
+	fillRect(img, image.Rect(27, 24, 29, 33), 90) // "5"
+	return img
+}
+
+func TestIsFullDigit(t *testing.T) {
+	img := drawCell()
+	fillRect(img, image.Rect(24, 10, 30, 46), 20)
+	digit, ok := centralComponent(inkImage(*img, 128))
+	assert.True(t, ok)
+	assert.True(t, isFullDigit(digit, *img))
+
+	// Pencil marks are too small to be found at all
+	_, ok = centralComponent(inkImage(*drawPencilMarks(), 128))
+	assert.False(t, ok)
+
+	small := drawCell()
+	fillRect(small, image.Rect(10, 8, 18, 17), 90)
+	mark, ok := centralComponent(inkImage(*small, 128))
+	assert.True(t, ok)
+	assert.False(t, isFullDigit(mark, *small))
+}
+
+func TestPencilTiles(t *testing.T) {
+	tiles, marked := pencilTiles(*drawPencilMarks(), 128)
+	assert.Len(t, tiles, 9)
+	assert.Equal(t, []bool{true, false, false, false, true, false, false, false, false}, marked)
+	for _, tile := range tiles {
+		assert.Equal(t, image.Rect(0, 0, 28, 28), tile.Bounds())
+	}
+}
+
+func TestPencilDigit(t *testing.T) {
+	testCases := []struct {
+		probabilities digits.Probabilities
+		position      int
+		digit         int
+		confidence    float64
+	}{
+		{digits.Probabilities{0, 0.46, 0, 0, 0, 0, 0, 0.48, 0, 0}, 0, 1, 0.46}, // Unclear, place in layout decides
+		{digits.Probabilities{0, 0.3, 0, 0, 0, 0, 0, 0.4, 0, 0}, 0, 7, 0.4},
+		{digits.Probabilities{0, 0.05, 0, 0, 0, 0, 0, 0.9, 0, 0}, 0, 7, 0.9},
+		{digits.Probabilities{0.9, 0, 0, 0, 0, 0.1, 0, 0, 0, 0}, 4, 5, 0.1}, // Zero is never a candidate
+		{digits.Probabilities{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 4, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		digit, confidence := pencilDigit(tc.probabilities, tc.position)
+		assert.Equal(t, tc.digit, digit)
+		assert.Equal(t, tc.confidence, confidence) // Probability given by the network
+	}
+}
+
+func TestPencilMarks(t *testing.T) {
+	recognitions := make([]digits.Recognition, 9, 9)
+	for i := range recognitions {
+		recognitions[i].DigitProbabilities = make(digits.Probabilities, 10, 10)
+	}
+	recognitions[0].DigitProbabilities[1] = 0.9
+	// 7 written off its usual place, in the middle of the cell
+	recognitions[4].DigitProbabilities[7] = 0.7
+	recognitions[4].DigitProbabilities[5] = 0.3
+	// Not sure enough
+	recognitions[8].DigitProbabilities[9] = 0.4
+	recognitions[8].DigitProbabilities[4] = 0.35
+	// Not marked
+	recognitions[2].DigitProbabilities[3] = 1
+
+	marked := []bool{true, false, false, false, true, false, false, false, true}
+	assert.Equal(t, []int{1, 7}, pencilMarks(recognitions, marked))
+	assert.Nil(t, pencilMarks(recognitions, make([]bool, 9, 9)))
+}
@@ -2,6 +2,8 @@ package sudoku
 
 import (
 	"image"
+	"image/color"
+	"image/draw"
 	"math"
 	"sync"
 
@@ -90,8 +92,69 @@ func newPerspective(src [4]pointF, dst [4]pointF) *perspectiveTrasnformation {
 	return projection
 }
 
+// Matrix returns homography as 3x3 matrix, normalised so H33 is 1 when possible
+func (p *perspectiveTrasnformation) Matrix() [3][3]float64 {
+	norm := p.H33
+	if math.Abs(norm) < 1e-12 {
+		norm = 1
+	}
+	return [3][3]float64{
+		{p.H11 / norm, p.H12 / norm, p.H13 / norm},
+		{p.H21 / norm, p.H22 / norm, p.H23 / norm},
+		{p.H31 / norm, p.H32 / norm, p.H33 / norm},
+	}
+}
+
+// Transformation of given 3x3 homography matrix, see Matrix
+func perspectiveFromMatrix(m [3][3]float64) *perspectiveTrasnformation {
+	return &perspectiveTrasnformation{
+		H11: m[0][0], H12: m[0][1], H13: m[0][2],
+		H21: m[1][0], H22: m[1][1], H23: m[1][2],
+		H31: m[2][0], H32: m[2][1], H33: m[2][2],
+	}
+}
+
+// Inverse transformation, maps destination points back to the source
+func (p *perspectiveTrasnformation) inverse() *perspectiveTrasnformation {
+	// Adjugate of homography matrix, scale does not matter
+	inv := &perspectiveTrasnformation{
+		srcPoints: p.dstPoints,
+		dstPoints: p.srcPoints,
+		H11:       p.H22*p.H33 - p.H23*p.H32,
+		H12:       p.H13*p.H32 - p.H12*p.H33,
+		H13:       p.H12*p.H23 - p.H13*p.H22,
+		H21:       p.H23*p.H31 - p.H21*p.H33,
+		H22:       p.H11*p.H33 - p.H13*p.H31,
+		H23:       p.H13*p.H21 - p.H11*p.H23,
+		H31:       p.H21*p.H32 - p.H22*p.H31,
+		H32:       p.H12*p.H31 - p.H11*p.H32,
+		H33:       p.H11*p.H22 - p.H12*p.H21,
+	}
+	return inv
+}
+
+// Bilinear interpolation of pixel value at given position.
+// Pixels outside of the image are black.
+func bilinearAt(src image.Gray, x, y float64) uint8 {
+	bounds := src.Bounds()
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	pixel := func(x, y int) float64 {
+		if x < bounds.Min.X || x >= bounds.Max.X || y < bounds.Min.Y || y >= bounds.Max.Y {
+			return 0
+		}
+		return float64(src.Pix[src.PixOffset(x, y)])
+	}
+
+	top := pixel(x0, y0)*(1-fx) + pixel(x0+1, y0)*fx
+	bottom := pixel(x0, y0+1)*(1-fx) + pixel(x0+1, y0+1)*fx
+	return uint8(math.Min(255, top*(1-fy)+bottom*fy+0.5))
+}
+
+// Warps source image into image big enough to hold all destination points.
+// Every destination pixel is mapped back to the source and interpolated.
 func (p *perspectiveTrasnformation) warpPerspective(src image.Gray) image.Gray {
-	var wg sync.WaitGroup
 	maxX := 0.0
 	maxY := 0.0
 	for _, p := range p.dstPoints {
@@ -99,84 +162,93 @@ func (p *perspectiveTrasnformation) warpPerspective(src image.Gray) image.Gray {
 		maxY = math.Max(maxY, p.Y)
 	}
 	dst := *image.NewGray(image.Rect(0, 0, int(maxX), int(maxY)))
-	mask := make([]bool, len(dst.Pix), len(dst.Pix))
+	p.warpArea(src, dst, dst.Bounds())
+	return dst
+}
 
-	srcWidth := src.Bounds().Max.X
-	srcHeight := src.Bounds().Max.Y
-	for x := 0; x < srcWidth; x++ {
+// Calls fill for every row of the area, each row in its own goroutine
+func parallelRows(area image.Rectangle, fill func(y int)) {
+	var wg sync.WaitGroup
+	for y := area.Min.Y; y < area.Max.Y; y++ {
 		wg.Add(1)
-		go func(x int) {
-			for y := 0; y < srcHeight; y++ {
-				newX, newY := p.Project(float64(x), float64(y))
-				if newX < 0 || newX >= maxX || newY < 0 || newY >= maxY {
-					continue
-				}
-
-				g := src.Pix[src.PixOffset(x, y)]
-
-				dstPos := dst.PixOffset(int(newX), int(newY))
-				dst.Pix[dstPos] = g
-				mask[dstPos] = true
-			}
+		go func(y int) {
+			fill(y)
 			wg.Done()
-		}(x)
+		}(y)
 	}
-
 	wg.Wait()
-	interpolateMissingPixels(dst, mask)
-	return dst
 }
 
-// Fill in missing pixels
-func interpolateMissingPixels(img image.Gray, mask []bool) {
-	var wg sync.WaitGroup
-	newMask := make([]bool, len(mask), len(mask))
-	copy(newMask, mask)
-	couldNotFill := false
+// Fills only given area of destination image.
+// Coordinates are the same as bounds of the images, they don't have to start at (0, 0).
+func (p *perspectiveTrasnformation) warpArea(src image.Gray, dst image.Gray, area image.Rectangle) {
+	inv := p.inverse()
+	area = area.Intersect(dst.Bounds())
+
+	parallelRows(area, func(y int) {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			srcX, srcY := inv.Project(float64(x), float64(y))
+			dst.Pix[dst.PixOffset(x, y)] = bilinearAt(src, srcX, srcY)
+		}
+	})
+}
 
-	imgWidth := img.Bounds().Max.X
-	imgHeight := img.Bounds().Max.Y
-	for x := 0; x < imgWidth; x++ {
-		wg.Add(1)
-		go func(x int) {
-			for y := 0; y < imgHeight; y++ {
-				imgPos := img.PixOffset(x, y)
-				if mask[imgPos] == true {
-					continue
-				}
-
-				var sum int
-				cnt := 0
-
-				if x > 0 && mask[imgPos-1] {
-					sum += int(img.Pix[imgPos-1])
-					cnt++
-				}
-				if x < imgWidth-1 && mask[imgPos+1] {
-					sum += int(img.Pix[imgPos+1])
-					cnt++
-				}
-				if y > 0 && mask[imgPos-img.Stride] {
-					sum += int(img.Pix[imgPos-img.Stride])
-					cnt++
-				}
-				if y < imgHeight-1 && mask[imgPos+img.Stride] {
-					sum += int(img.Pix[imgPos+img.Stride])
-					cnt++
-				}
-				if cnt != 0 {
-					img.Pix[imgPos] = uint8(sum / cnt)
-					newMask[imgPos] = true
-				} else {
-					couldNotFill = true
-				}
-			}
-			wg.Done()
-		}(x)
+// Bilinear interpolation of colour at given position, with premultiplied alpha.
+// Pixels outside of the image are transparent.
+func bilinearColorAt(src image.Image, x, y float64) color.RGBA64 {
+	bounds := src.Bounds()
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	var r, g, b, a float64
+	add := func(px, py int, weight float64) {
+		if weight == 0 || !(image.Point{px, py}).In(bounds) {
+			return
+		}
+		pr, pg, pb, pa := src.At(px, py).RGBA()
+		r += float64(pr) * weight
+		g += float64(pg) * weight
+		b += float64(pb) * weight
+		a += float64(pa) * weight
 	}
+	add(x0, y0, (1-fx)*(1-fy))
+	add(x0+1, y0, fx*(1-fy))
+	add(x0, y0+1, (1-fx)*fy)
+	add(x0+1, y0+1, fx*fy)
 
-	wg.Wait()
-	if couldNotFill {
-		interpolateMissingPixels(img, newMask)
+	channel := func(v float64) uint16 {
+		return uint16(math.Min(0xffff, v+0.5))
+	}
+	return color.RGBA64{R: channel(r), G: channel(g), B: channel(b), A: channel(a)}
+}
+
+// Warps any image into given area of destination image, e.g. *image.RGBA or *image.NRGBA.
+// Gray images are warped without conversion to colour.
+func (p *perspectiveTrasnformation) warpImage(src image.Image, dst draw.Image, area image.Rectangle) {
+	srcGray, srcIsGray := src.(*image.Gray)
+	dstGray, dstIsGray := dst.(*image.Gray)
+	if srcIsGray && dstIsGray {
+		p.warpArea(*srcGray, *dstGray, area)
+		return
+	}
+
+	inv := p.inverse()
+	area = area.Intersect(dst.Bounds())
+	fill := func(y int) {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			srcX, srcY := inv.Project(float64(x), float64(y))
+			dst.Set(x, y, bilinearColorAt(src, srcX, srcY))
+		}
+	}
+
+	switch dst.(type) {
+	case *image.RGBA, *image.NRGBA:
+		// Rows don't share memory, so they can be set at the same time
+		parallelRows(area, fill)
+	default:
+		// Set of other images might not be safe to call concurrently
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			fill(y)
+		}
 	}
 }
@@ -1,6 +1,8 @@
 package sudoku
 
 import (
+	"image"
+	"image/color"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,3 +31,166 @@ func TestPerspectiveTransformation(t *testing.T) {
 		assert.InDelta(t, y, dst[i].Y, 0.001)
 	}
 }
+
+func TestPerspectiveInverse(t *testing.T) {
+	src := [4]pointF{
+		pointF{54, 64},
+		pointF{368, 52},
+		pointF{391, 391},
+		pointF{27, 387},
+	}
+
+	dst := [4]pointF{
+		pointF{0, 0},
+		pointF{420, 0},
+		pointF{420, 420},
+		pointF{0, 420},
+	}
+
+	inv := newPerspective(src, dst).inverse()
+
+	for i := range dst {
+		x, y := inv.Project(dst[i].X, dst[i].Y)
+		assert.InDelta(t, src[i].X, x, 0.001)
+		assert.InDelta(t, src[i].Y, y, 0.001)
+	}
+}
+
+func TestBilinearAt(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	img.Pix = []uint8{
+		0, 100,
+		200, 255,
+	}
+
+	testCases := []struct {
+		x, y     float64
+		expected uint8
+	}{
+		{0, 0, 0},
+		{1, 0, 100},
+		{0.5, 0, 50},
+		{0, 0.5, 100},
+		{0.5, 0.5, 139},
+		{1, 1, 255},
+		{1.5, 1, 128}, // Half outside of the image
+		{-5, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, bilinearAt(*img, tc.x, tc.y), "Point %v, %v", tc.x, tc.y)
+	}
+}
+
+func TestWarpPerspective(t *testing.T) {
+	// Square 10-30 scaled up twice
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			img.Pix[img.PixOffset(x, y)] = uint8(x * 5)
+		}
+	}
+
+	src := [4]pointF{
+		pointF{10, 10},
+		pointF{30, 10},
+		pointF{30, 30},
+		pointF{10, 30},
+	}
+	dst := [4]pointF{
+		pointF{0, 0},
+		pointF{40, 0},
+		pointF{40, 40},
+		pointF{0, 40},
+	}
+
+	warped := newPerspective(src, dst).warpPerspective(*img)
+
+	assert.Equal(t, image.Rect(0, 0, 40, 40), warped.Bounds())
+	assert.Equal(t, uint8(50), warped.GrayAt(0, 0).Y)
+	assert.Equal(t, uint8(53), warped.GrayAt(1, 20).Y) // Between 50 and 55
+	assert.Equal(t, uint8(100), warped.GrayAt(20, 38).Y)
+}
+
+func TestBilinearColorAt(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 0, 255, 255})
+
+	assert.Equal(t, color.RGBA64{0xffff, 0, 0, 0xffff}, bilinearColorAt(img, 0, 0))
+	assert.Equal(t, color.RGBA64{0x8000, 0, 0x8000, 0xffff}, bilinearColorAt(img, 0.5, 0))
+	assert.Equal(t, color.RGBA64{0, 0, 0x8000, 0x8000}, bilinearColorAt(img, 1, 0.5)) // Half outside
+	assert.Equal(t, color.RGBA64{}, bilinearColorAt(img, 5, 5))
+}
+
+func TestWarpImage(t *testing.T) {
+	// Left half red, right half blue
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.NRGBA{0, 0, 255, 255})
+			}
+		}
+	}
+
+	src := [4]pointF{
+		pointF{0, 0},
+		pointF{40, 0},
+		pointF{40, 20},
+		pointF{0, 20},
+	}
+	dst := [4]pointF{
+		pointF{0, 0},
+		pointF{20, 0},
+		pointF{20, 30},
+		pointF{0, 30},
+	}
+
+	proj := newPerspective(src, dst)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 20, 30))
+	proj.warpImage(img, rgba, rgba.Bounds())
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, rgba.At(2, 15))
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, rgba.At(15, 15))
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 20, 30))
+	proj.warpImage(img, nrgba, image.Rect(10, 0, 20, 30))
+	assert.Equal(t, color.NRGBA{}, nrgba.At(2, 15)) // Outside of warped area
+	assert.Equal(t, color.NRGBA{0, 0, 255, 255}, nrgba.At(15, 15))
+
+	gray := image.NewGray(image.Rect(0, 0, 40, 20))
+	gray.Pix[gray.PixOffset(30, 10)] = 255
+	grayDst := image.NewGray(image.Rect(0, 0, 20, 30))
+	proj.warpImage(gray, grayDst, grayDst.Bounds())
+	assert.Equal(t, uint8(255), grayDst.GrayAt(15, 15).Y)
+
+	// Destination not starting at (0, 0)
+	grayPart := grayDst.SubImage(image.Rect(10, 10, 20, 20)).(*image.Gray)
+	for i := range grayDst.Pix {
+		grayDst.Pix[i] = 0
+	}
+	proj.warpImage(gray, grayPart, grayPart.Bounds())
+	assert.Equal(t, uint8(255), grayPart.GrayAt(15, 15).Y)
+	assert.Equal(t, uint8(0), grayDst.GrayAt(5, 15).Y) // Outside of destination
+
+	rgbaPart := image.NewRGBA(image.Rect(10, 10, 20, 20))
+	proj.warpImage(img, rgbaPart, rgbaPart.Bounds())
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, rgbaPart.At(15, 15))
+
+	// Other destination images are filled row by row
+	paletted := image.NewPaletted(image.Rect(0, 0, 20, 30), color.Palette{color.Black, color.RGBA{0, 0, 255, 255}})
+	proj.warpImage(img, paletted, paletted.Bounds())
+	assert.Equal(t, uint8(1), paletted.ColorIndexAt(15, 15))
+}
+
+func TestBilinearAtSubImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	img.Pix[img.PixOffset(6, 6)] = 200
+	part := img.SubImage(image.Rect(5, 5, 10, 10)).(*image.Gray)
+
+	assert.Equal(t, uint8(200), bilinearAt(*part, 6, 6))
+	assert.Equal(t, uint8(0), bilinearAt(*part, 2, 2)) // Outside of sub image
+}
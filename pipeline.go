@@ -0,0 +1,55 @@
+package sudoku
+
+import (
+	"image"
+)
+
+// Stage is a single step of image pre-processing
+type Stage interface {
+	Apply(src image.Gray) image.Gray
+}
+
+// StageFunc allows to use ordinary functions as pre-processing stages
+type StageFunc func(src image.Gray) image.Gray
+
+// Apply calls f(src)
+func (f StageFunc) Apply(src image.Gray) image.Gray {
+	return f(src)
+}
+
+// Pipeline chains stages that turn original image into binary image
+// used to look for sudoku grid.
+// Stages are applied in order to gray scale version of the original image.
+type Pipeline struct {
+	Stages []Stage
+}
+
+// NewPipeline creates pipeline from given stages
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{Stages: stages}
+}
+
+// DefaultPipeline returns pipeline that works well for most of the images:
+// - threshold to produce binary image
+// - removes some of big areas/blobs
+func DefaultPipeline() *Pipeline {
+	return NewPipeline(
+		StageFunc(binarize),
+		StageFunc(removeBlobsBody),
+	)
+}
+
+// Run converts image to gray scale and applies all stages.
+// Returns final image and output of every step (starting with gray scale image)
+// which is handy for debugging.
+func (p *Pipeline) Run(img image.Image) (image.Gray, []image.Gray) {
+	current := grayImage(img)
+	intermediate := make([]image.Gray, 0, len(p.Stages)+1)
+	intermediate = append(intermediate, current)
+
+	for _, stage := range p.Stages {
+		current = stage.Apply(current)
+		intermediate = append(intermediate, current)
+	}
+	return current, intermediate
+}
@@ -0,0 +1,60 @@
+package sudoku
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelineRun(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{10})
+	img.SetGray(1, 0, color.Gray{200})
+
+	invert := StageFunc(func(src image.Gray) image.Gray {
+		dst := *image.NewGray(src.Bounds())
+		for i, pix := range src.Pix {
+			dst.Pix[i] = 255 - pix
+		}
+		return dst
+	})
+	addOne := StageFunc(func(src image.Gray) image.Gray {
+		dst := *image.NewGray(src.Bounds())
+		for i, pix := range src.Pix {
+			dst.Pix[i] = pix + 1
+		}
+		return dst
+	})
+
+	result, stages := NewPipeline(invert, addOne).Run(img)
+
+	assert.Len(t, stages, 3)
+	assert.EqualValues(t, []uint8{10, 200}, stages[0].Pix)
+	assert.EqualValues(t, []uint8{245, 55}, stages[1].Pix)
+	assert.EqualValues(t, []uint8{246, 56}, stages[2].Pix)
+	assert.EqualValues(t, stages[2].Pix, result.Pix)
+}
+
+func TestDefaultPipeline(t *testing.T) {
+	assert.Len(t, DefaultPipeline().Stages, 2)
+}
+
+func TestStagesOfSudoku(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 20))
+	invert := StageFunc(func(src image.Gray) image.Gray {
+		dst := *image.NewGray(src.Bounds())
+		for i, pix := range src.Pix {
+			dst.Pix[i] = 255 - pix
+		}
+		return dst
+	})
+
+	// Stages of shrunk image, even when sudoku is not found
+	s := prepareSudoku(img, Options{Pipeline: NewPipeline(invert), MaxDimension: 20})
+	stages := s.Stages()
+	assert.Len(t, stages, 2)
+	assert.Equal(t, image.Rect(0, 0, 20, 10), stages[1].Bounds())
+	assert.Equal(t, uint8(255), stages[1].Pix[0])
+}
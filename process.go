@@ -69,13 +69,46 @@ func removeBlobsBody(src image.Gray) (dst image.Gray) {
 	return adaptiveThreshold(src, 255, threshBinary, (window-1)/2, -128)
 }
 
-// PreProcess prepares original image for actual work
-// - coverts to gray scale
-// - threshold to produce binary image
-// - removes some of big areas/blobs
-func preProcess(img image.Image) image.Gray {
-	grayImg := grayImage(img)
-	binary := binarize(grayImg)
-	deblobbed := removeBlobsBody(binary)
-	return deblobbed
+// Shrinks image, so its longer side is not longer than maxDimension.
+// Every pixel is an average of the area it covers in the original image.
+// Returns resized image and scale that maps coordinates back to original size.
+func downscale(src image.Gray, maxDimension int) (image.Gray, float64) {
+	var wg sync.WaitGroup
+	w, h := src.Bounds().Max.X, src.Bounds().Max.Y
+
+	longer := w
+	if h > longer {
+		longer = h
+	}
+	if maxDimension <= 0 || longer <= maxDimension {
+		return src, 1
+	}
+
+	scale := float64(longer) / float64(maxDimension)
+	dstW, dstH := int(float64(w)/scale), int(float64(h)/scale)
+	dst := *image.NewGray(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		wg.Add(1)
+		go func(y int) {
+			y0, y1 := int(float64(y)*scale), minInt(int(float64(y+1)*scale), h)
+			for x := 0; x < dstW; x++ {
+				x0, x1 := int(float64(x)*scale), minInt(int(float64(x+1)*scale), w)
+
+				sum, count := 0, 0
+				for sy := y0; sy < y1; sy++ {
+					for sx := x0; sx < x1; sx++ {
+						sum += int(src.Pix[src.PixOffset(sx, sy)])
+						count++
+					}
+				}
+				if count > 0 {
+					dst.Pix[dst.PixOffset(x, y)] = uint8(sum / count)
+				}
+			}
+			wg.Done()
+		}(y)
+	}
+	wg.Wait()
+	return dst, scale
 }
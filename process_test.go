@@ -0,0 +1,46 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownscale(t *testing.T) {
+	var examples = []struct {
+		width         int
+		height        int
+		maxDimension  int
+		expectedW     int
+		expectedH     int
+		expectedScale float64
+	}{
+		{100, 50, 200, 100, 50, 1},
+		{100, 50, 100, 100, 50, 1},
+		{100, 50, 0, 100, 50, 1},
+		{100, 50, 50, 50, 25, 2},
+		{50, 100, 25, 12, 25, 4},
+		{300, 200, 200, 200, 133, 1.5},
+	}
+
+	for _, tt := range examples {
+		img := image.NewGray(image.Rect(0, 0, tt.width, tt.height))
+		resized, scale := downscale(*img, tt.maxDimension)
+		assert.Equal(t, tt.expectedW, resized.Bounds().Dx())
+		assert.Equal(t, tt.expectedH, resized.Bounds().Dy())
+		assert.InDelta(t, tt.expectedScale, scale, 0.0001)
+	}
+}
+
+func TestDownscaleAveragesPixels(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	copy(img.Pix, []uint8{
+		0, 100, 10, 10,
+		100, 200, 20, 40,
+	})
+
+	resized, scale := downscale(*img, 2)
+	assert.Equal(t, 2.0, scale)
+	assert.EqualValues(t, []uint8{100, 20}, resized.Pix)
+}
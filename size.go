@@ -0,0 +1,39 @@
+package sudoku
+
+// GridSize describes layout of the puzzle
+type GridSize struct {
+	Cells     int // Number of cells in each row and column
+	BoxWidth  int // Number of columns in a box
+	BoxHeight int // Number of rows in a box
+}
+
+// Supported puzzle layouts
+var (
+	Grid4x4   = GridSize{Cells: 4, BoxWidth: 2, BoxHeight: 2}
+	Grid6x6   = GridSize{Cells: 6, BoxWidth: 3, BoxHeight: 2}
+	Grid9x9   = GridSize{Cells: 9, BoxWidth: 3, BoxHeight: 3}
+	Grid12x12 = GridSize{Cells: 12, BoxWidth: 4, BoxHeight: 3}
+	Grid16x16 = GridSize{Cells: 16, BoxWidth: 4, BoxHeight: 4}
+)
+
+// GridSizes maps supported layouts by number of cells in a row
+var GridSizes = map[int]GridSize{
+	4:  Grid4x4,
+	6:  Grid6x6,
+	9:  Grid9x9,
+	12: Grid12x12,
+	16: Grid16x16,
+}
+
+// Lines returns number of lines in each direction, including outer borders
+func (s GridSize) Lines() int {
+	return s.Cells + 1
+}
+
+// Valid checks if boxes fill the grid without gaps
+func (s GridSize) Valid() bool {
+	if s.Cells <= 0 || s.BoxWidth <= 0 || s.BoxHeight <= 0 {
+		return false
+	}
+	return s.Cells%s.BoxWidth == 0 && s.Cells%s.BoxHeight == 0 && s.BoxWidth*s.BoxHeight == s.Cells
+}
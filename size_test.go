@@ -0,0 +1,46 @@
+package sudoku
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGridSizeValid(t *testing.T) {
+	var examples = []struct {
+		size  GridSize
+		valid bool
+	}{
+		{Grid4x4, true},
+		{Grid6x6, true},
+		{Grid9x9, true},
+		{Grid12x12, true},
+		{Grid16x16, true},
+		{GridSize{}, false},
+		{GridSize{Cells: 6, BoxWidth: 3, BoxHeight: 3}, false},
+		{GridSize{Cells: 8, BoxWidth: 3, BoxHeight: 3}, false},
+		{GridSize{Cells: -4, BoxWidth: -2, BoxHeight: 2}, false},
+	}
+
+	for _, tt := range examples {
+		assert.Equal(t, tt.valid, tt.size.Valid(), "%+v", tt.size)
+	}
+	for cells, size := range GridSizes {
+		assert.Equal(t, cells, size.Cells)
+		assert.Equal(t, cells+1, size.Lines())
+	}
+}
+
+func TestInvalidSizeOption(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	options := Options{Size: GridSize{Cells: 8, BoxWidth: 3, BoxHeight: 3}}
+
+	s, err := NewSudokuWithOptions(img, options)
+	assert.Nil(t, s)
+	assert.Equal(t, ErrInvalidSize, err)
+
+	sudokus, err := FindAllWithOptions(img, options)
+	assert.Nil(t, sudokus)
+	assert.Equal(t, ErrInvalidSize, err)
+}
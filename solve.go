@@ -0,0 +1,122 @@
+package sudoku
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// ErrNoSolution is reported when digits on the board break the rules
+// or the board could not be filled within maxSolveSteps
+var ErrNoSolution = errors.New("Could not solve sudoku")
+
+// Limits backtracking, board with misread digits can take long to rule out
+const maxSolveSteps = 200000
+
+// Digits used in rows, columns and boxes, bit per digit
+type solver struct {
+	size  GridSize
+	board [][]int
+	rows  []uint32
+	cols  []uint32
+	boxes []uint32
+	steps int
+}
+
+func (s *solver) box(row, col int) int {
+	return row/s.size.BoxHeight*(s.size.Cells/s.size.BoxWidth) + col/s.size.BoxWidth
+}
+
+func (s *solver) used(row, col int) uint32 {
+	return s.rows[row] | s.cols[col] | s.boxes[s.box(row, col)]
+}
+
+// Puts digit into the cell or takes it back when it's already there
+func (s *solver) toggle(row, col, digit int) {
+	bit := uint32(1) << uint(digit)
+	s.rows[row] ^= bit
+	s.cols[col] ^= bit
+	s.boxes[s.box(row, col)] ^= bit
+	if s.board[row][col] == digit {
+		s.board[row][col] = 0
+	} else {
+		s.board[row][col] = digit
+	}
+}
+
+// Backtracking, the cell with the fewest candidates is filled first
+func (s *solver) solve() bool {
+	s.steps++
+	if s.steps > maxSolveSteps {
+		return false
+	}
+
+	all := uint32(1)<<uint(s.size.Cells+1) - 2 // Digits 1 to Cells
+	bestRow, bestCol, bestCount := -1, -1, s.size.Cells+1
+	var best uint32
+	for row := range s.board {
+		for col, digit := range s.board[row] {
+			if digit != 0 {
+				continue
+			}
+			candidates := all &^ s.used(row, col)
+			count := bits.OnesCount32(candidates)
+			if count == 0 {
+				return false
+			}
+			if count < bestCount {
+				bestRow, bestCol, bestCount, best = row, col, count, candidates
+			}
+		}
+	}
+	if bestRow < 0 {
+		return true
+	}
+
+	for digit := 1; digit <= s.size.Cells; digit++ {
+		if best&(1<<uint(digit)) == 0 {
+			continue
+		}
+		s.toggle(bestRow, bestCol, digit)
+		if s.solve() {
+			return true
+		}
+		s.toggle(bestRow, bestCol, digit)
+	}
+	return false
+}
+
+// Solve fills empty cells (0) of the board [row][col], given digits are kept.
+// Board is not modified, solution is returned as a new one.
+func Solve(board [][]int, size GridSize) ([][]int, error) {
+	if !size.Valid() || size.Cells > 31 || len(board) != size.Cells {
+		return nil, ErrInvalidSize
+	}
+
+	s := &solver{
+		size:  size,
+		board: make([][]int, size.Cells, size.Cells),
+		rows:  make([]uint32, size.Cells, size.Cells),
+		cols:  make([]uint32, size.Cells, size.Cells),
+		boxes: make([]uint32, size.Cells, size.Cells),
+	}
+	for row := range board {
+		if len(board[row]) != size.Cells {
+			return nil, ErrInvalidSize
+		}
+		s.board[row] = make([]int, size.Cells, size.Cells)
+		for col, digit := range board[row] {
+			if digit == 0 {
+				continue
+			}
+			if digit < 0 || digit > size.Cells || s.used(row, col)&(1<<uint(digit)) != 0 {
+				return nil, ErrNoSolution
+			}
+			s.toggle(row, col, digit)
+		}
+	}
+
+	if !s.solve() {
+		return nil, ErrNoSolution
+	}
+	return s.board, nil
+}
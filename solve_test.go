@@ -0,0 +1,103 @@
+package sudoku
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseBoard(rows ...string) [][]int {
+	board := make([][]int, len(rows), len(rows))
+	for r, row := range rows {
+		for _, char := range row {
+			board[r] = append(board[r], int(char-'0'))
+		}
+	}
+	return board
+}
+
+// Every row, column and box has all digits
+func assertSolved(t *testing.T, board [][]int, size GridSize) {
+	for i := 0; i < size.Cells; i++ {
+		row, col, box := map[int]bool{}, map[int]bool{}, map[int]bool{}
+		boxRow := i / (size.Cells / size.BoxWidth) * size.BoxHeight
+		boxCol := i % (size.Cells / size.BoxWidth) * size.BoxWidth
+		for j := 0; j < size.Cells; j++ {
+			row[board[i][j]] = true
+			col[board[j][i]] = true
+			box[board[boxRow+j/size.BoxWidth][boxCol+j%size.BoxWidth]] = true
+		}
+		for digit := 1; digit <= size.Cells; digit++ {
+			assert.True(t, row[digit] && col[digit] && box[digit], "%v missing in row, column or box %v", digit, i)
+		}
+	}
+}
+
+func TestSolve(t *testing.T) {
+	board := parseBoard(
+		"530070000",
+		"600195000",
+		"098000060",
+		"800060003",
+		"400803001",
+		"700020006",
+		"060000280",
+		"000419005",
+		"000080079",
+	)
+	expected := parseBoard(
+		"534678912",
+		"672195348",
+		"198342567",
+		"859761423",
+		"426853791",
+		"713924856",
+		"961537284",
+		"287419635",
+		"345286179",
+	)
+
+	solution, err := Solve(board, Grid9x9)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, solution)
+	assert.Equal(t, 0, board[0][2], "board is not modified")
+}
+
+func TestSolveSizes(t *testing.T) {
+	for _, size := range GridSizes {
+		board := make([][]int, size.Cells, size.Cells)
+		for row := range board {
+			board[row] = make([]int, size.Cells, size.Cells)
+		}
+		board[0][0] = size.Cells
+
+		solution, err := Solve(board, size)
+		if assert.Nil(t, err, "%v", size) {
+			assertSolved(t, solution, size)
+			assert.Equal(t, size.Cells, solution[0][0])
+		}
+	}
+}
+
+func TestSolveErrors(t *testing.T) {
+	testCases := []struct {
+		board [][]int
+		size  GridSize
+		err   error
+	}{
+		{parseBoard("1200", "0030", "0040", "0000"), Grid4x4, ErrNoSolution}, // No digit fits top-right cells
+		{parseBoard("1001", "0000", "0000", "0000"), Grid4x4, ErrNoSolution}, // Row
+		{parseBoard("1000", "0000", "1000", "0000"), Grid4x4, ErrNoSolution}, // Column
+		{parseBoard("1000", "0100", "0000", "0000"), Grid4x4, ErrNoSolution}, // Box
+		{parseBoard("5000", "0000", "0000", "0000"), Grid4x4, ErrNoSolution}, // Digit out of range
+		{parseBoard("000", "000", "000"), Grid4x4, ErrInvalidSize},
+		{parseBoard("0000", "000", "0000", "0000"), Grid4x4, ErrInvalidSize},
+		{parseBoard("0000", "0000", "0000", "0000"), GridSize{Cells: 4, BoxWidth: 3, BoxHeight: 2}, ErrInvalidSize},
+	}
+
+	for i, tc := range testCases {
+		solution, err := Solve(tc.board, tc.size)
+		assert.Nil(t, solution, "case %v", i)
+		assert.Equal(t, tc.err, err, "case %v", i)
+	}
+}
@@ -6,25 +6,143 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mrfuxi/sudoku/nngrid"
 )
 
+const (
+	// DefaultMaxDimension limits size of image used to locate sudoku
+	DefaultMaxDimension = 1024
+	// DefaultMinScore is the lowest score of grid accepted by FindAll
+	DefaultMinScore = 0.3
+)
+
+// ErrInvalidSize is reported when boxes of requested grid size do not fill the grid
+var ErrInvalidSize = errors.New("Invalid size of sudoku grid")
+
 // ErrNotRecognised is reported when sudoku could not be localized on image
 var ErrNotRecognised = errors.New("Could not find sudoku on the image")
 
 // Sudoku interface describes access to recognised sudoku puzzle
 type Sudoku interface {
 	Overlay() image.Image
+	// Extracted returns flattened puzzle, nil when size is not positive
 	Extracted(imageSize int) image.Image
+	ExtractedWithOptions(options ExtractOptions) image.Image
+	// Corners returns all intersections of grid lines, indexed [row][col]
+	Corners() [][]Corner
+	// Geometry describes position of the puzzle on the image
+	Geometry() *Geometry
+	// CellAt finds cell [row][col] at given point of the image
+	CellAt(x, y float64) (row, col int, ok bool)
+	// Cells returns images of cells [row][col] as given to digit recognition:
+	// 28x28, dark digit centred on white background, grid lines removed
+	Cells() [][]image.Gray
+	// Digits returns recognised cells [row][col], or the reason why digits could not be
+	// recognised, e.g. digits.ErrNoNetwork.
+	// Every digit is marked as printed or handwritten, empty cells have pencil marks if any.
+	Digits() ([][]RecognisedCell, error)
+	// Stages returns output of every pre-processing stage, starting with gray scale image.
+	// Images are shrunk like the one used to find the grid, see Options.MaxDimension.
+	// They are available also when sudoku was not recognised.
+	Stages() []image.Gray
+}
+
+// Options allows to tune how sudoku is searched for on the image
+type Options struct {
+	// Pipeline used to prepare binary image, DefaultPipeline is used when nil
+	Pipeline *Pipeline
+	// CannyEdges makes Hough transform run on edges found by Canny edge detector.
+	// Every edge pixel votes only for lines close to its gradient direction.
+	CannyEdges bool
+	// MaxDimension limits longer side of image used to locate the grid.
+	// Bigger images are shrunk for detection only, found grid is mapped back
+	// to the original image. DefaultMaxDimension is used when 0, negative disables resizing.
+	MaxDimension int
+	// MinScore is the lowest score (0-1) of a grid reported by FindAll,
+	// weighted by how much of its lines is found on the image.
+	// DefaultMinScore is used when 0.
+	MinScore float64
+	// Size of the puzzle, Grid9x9 is used when not set
+	Size GridSize
+	// Mesh locates every intersection of the grid separately and warps each cell
+	// from its own corners. Use it for bent pages, e.g. photos of books near the spine.
+	Mesh bool
+	// Deskew straightens slanted digits before they are recognised
+	Deskew bool
+}
+
+// ExtractOptions describes flattened image of the puzzle
+type ExtractOptions struct {
+	// Size of the image, both have to be positive
+	Width  int
+	Height int
+	// Color keeps colours of the original image in *image.RGBA, otherwise *image.Gray is returned
+	Color bool
+	// NonPremultiplied makes colour image *image.NRGBA instead of *image.RGBA
+	NonPremultiplied bool
 }
 
 type lineSudoku struct {
-	BaseImage    image.Image
-	PreProcessed image.Gray
-	Grid         lineGrid
-	Recognised   bool
+	BaseImage     image.Image
+	PreProcessed  image.Gray   // Binary image used for detection, shrunk by Scale
+	Intermediate  []image.Gray // Output of every pre-processing stage, shrunk by Scale
+	Scale         float64
+	Size          GridSize
+	Grid          lineGrid
+	Intersections [][]Corner     // Refined intersections of grid lines [row][col] in original image
+	MeshMode      bool           // Cells are warped from their own corners
+	CellImages    [][]image.Gray // Cleaned 28x28 cells [row][col]
+	CellDigits    [][]RecognisedCell
+	DigitsErr     error // Why CellDigits are missing
+	Recognised    bool
+
+	geometryOnce sync.Once
+	geometry     *Geometry // Computed once, see Geometry
+}
+
+// Corners of cells [row][col]
+func (l *lineSudoku) cellMesh() [][]pointF {
+	return cornerPoints(l.Intersections)
+}
+
+// Sets grid found on pre-processed image
+func (l *lineSudoku) setGrid(grid lineGrid, options Options) {
+	l.Grid = grid.Scaled(l.Scale) // In original image coordinates
+	l.Intersections = scaleCorners(locateIntersections(l.PreProcessed, grid, options.Mesh), l.Scale)
+	l.MeshMode = options.Mesh
+	l.Recognised = true
+	l.CellImages, l.CellDigits, l.DigitsErr = extractCells(l.cellMesh(), l.BaseImage, options.Deskew)
+}
+
+func (l *lineSudoku) Cells() [][]image.Gray {
+	if !l.Recognised {
+		return nil
+	}
+	return l.CellImages
+}
+
+func (l *lineSudoku) Digits() ([][]RecognisedCell, error) {
+	if !l.Recognised {
+		return nil, ErrNotRecognised
+	}
+	return l.CellDigits, l.DigitsErr
+}
+
+func (l *lineSudoku) Stages() []image.Gray {
+	return l.Intermediate
+}
+
+func (l *lineSudoku) Corners() [][]Corner {
+	if !l.Recognised {
+		return nil
+	}
+	return l.Intersections
 }
 
 func (l *lineSudoku) Overlay() image.Image {
@@ -32,53 +150,129 @@ func (l *lineSudoku) Overlay() image.Image {
 		return nil
 	}
 
-	fragments := make([]lineFragment, 20, 20)
-	for i := 0; i < 10; i++ {
+	if l.MeshMode {
+		return drawLineFragments(l.BaseImage, meshFragments(l.cellMesh()))
+	}
+
+	lines := l.Size.Lines()
+	last := lines - 1
+	fragments := make([]lineFragment, 2*lines, 2*lines)
+	for i := 0; i < lines; i++ {
 		_, hStart := intersection(l.Grid.Horizontal[i], l.Grid.Vertical[0])
-		_, hEnd := intersection(l.Grid.Horizontal[i], l.Grid.Vertical[9])
+		_, hEnd := intersection(l.Grid.Horizontal[i], l.Grid.Vertical[last])
 		fragments[i] = lineFragment{hStart, hEnd}
 
 		_, vStart := intersection(l.Grid.Horizontal[0], l.Grid.Vertical[i])
-		_, vEnd := intersection(l.Grid.Horizontal[9], l.Grid.Vertical[i])
-		fragments[10+i] = lineFragment{vStart, vEnd}
+		_, vEnd := intersection(l.Grid.Horizontal[last], l.Grid.Vertical[i])
+		fragments[lines+i] = lineFragment{vStart, vEnd}
 	}
 
 	return drawLineFragments(l.BaseImage, fragments)
 }
 
-func (l *lineSudoku) Extracted(imageSize int) image.Image {
+// Homography mapping original image onto flat width x height puzzle
+func (l *lineSudoku) flattening(width, height float64) *perspectiveTrasnformation {
+	if proj, ok := meshHomography(l.Intersections, width, height); ok {
+		return proj
+	}
+
+	// Not enough good intersections, use outer corners only
+	mesh := l.cellMesh()
+	lastRow, lastCol := len(mesh)-1, len(mesh[0])-1
+	corners := [4]pointF{
+		mesh[0][0],
+		mesh[0][lastCol],
+		mesh[lastRow][lastCol],
+		mesh[lastRow][0],
+	}
+	flat := [4]pointF{
+		pointF{0, 0},
+		pointF{width, 0},
+		pointF{width, height},
+		pointF{0, height},
+	}
+	return newPerspective(corners, flat)
+}
+
+// Geometry fitted to intersections on the first call, it does not change later
+func (l *lineSudoku) cachedGeometry() *Geometry {
 	if !l.Recognised {
 		return nil
 	}
+	l.geometryOnce.Do(func() {
+		cells := float64(l.Size.Cells)
+		l.geometry = newGeometry(l.Size, l.Intersections, l.flattening(cells, cells), l.MeshMode)
+	})
+	return l.geometry
+}
+
+func (l *lineSudoku) Geometry() *Geometry {
+	geometry := l.cachedGeometry()
+	if geometry == nil {
+		return nil
+	}
+	return geometry.copy()
+}
 
-	_, p1 := intersection(l.Grid.Horizontal[0], l.Grid.Vertical[0])
-	_, p2 := intersection(l.Grid.Horizontal[0], l.Grid.Vertical[9])
-	_, p3 := intersection(l.Grid.Horizontal[9], l.Grid.Vertical[9])
-	_, p4 := intersection(l.Grid.Horizontal[9], l.Grid.Vertical[0])
+func (l *lineSudoku) CellAt(x, y float64) (row, col int, ok bool) {
+	geometry := l.cachedGeometry()
+	if geometry == nil {
+		return 0, 0, false
+	}
+	return geometry.CellAt(x, y)
+}
 
-	src := [4]pointF{
-		newPointF(p1),
-		newPointF(p2),
-		newPointF(p3),
-		newPointF(p4),
+func (l *lineSudoku) Extracted(imageSize int) image.Image {
+	return l.ExtractedWithOptions(ExtractOptions{Width: imageSize, Height: imageSize})
+}
+
+func (l *lineSudoku) ExtractedWithOptions(options ExtractOptions) image.Image {
+	if !l.Recognised || options.Width <= 0 || options.Height <= 0 {
+		return nil
 	}
 
-	size := float64(imageSize)
-	dst := [4]pointF{
-		pointF{0, 0},
-		pointF{size, 0},
-		pointF{size, size},
-		pointF{0, size},
+	bounds := image.Rect(0, 0, options.Width, options.Height)
+	var src image.Image
+	var dst draw.Image
+	switch {
+	case options.Color && options.NonPremultiplied:
+		src = l.BaseImage
+		dst = image.NewNRGBA(bounds)
+	case options.Color:
+		src = l.BaseImage
+		dst = image.NewRGBA(bounds)
+	default:
+		grayImg := grayImage(l.BaseImage)
+		src = &grayImg
+		dst = image.NewGray(bounds)
 	}
 
-	grayImg := grayImage(l.BaseImage)
+	if l.MeshMode {
+		warpMesh(src, dst, l.cellMesh())
+		return dst
+	}
+
+	proj := l.flattening(float64(options.Width), float64(options.Height))
+	proj.warpImage(src, dst, bounds)
+	return dst
+}
+
+// Set once grid network is loaded, until then nnGrid does nothing
+var gridNetworkLoaded int32
 
-	proj := newPerspective(src, dst)
-	warped := proj.warpPerspective(grayImg)
-	return &warped
+// LoadGridNetwork loads network recognising fragments of the grid (nngrid package).
+// It's optional, the network only draws debug image of grid fragments (grid.png).
+func LoadGridNetwork(fileName string) {
+	nngrid.LoadNetwork(fileName)
+	atomic.StoreInt32(&gridNetworkLoaded, 1)
 }
 
+// Saves grid fragments recognised by grid network as grid.png, when the network is loaded
 func nnGrid(img image.Gray) {
+	if atomic.LoadInt32(&gridNetworkLoaded) == 0 {
+		return
+	}
+
 	dst := *image.NewRGBA(img.Bounds())
 	draw.Draw(&dst, dst.Bounds(), &img, image.ZP, draw.Src)
 
@@ -119,21 +313,46 @@ func nnGrid(img image.Gray) {
 	saveImage(&dst, "grid.png")
 }
 
-// NewSudoku processes given image in order to find sudoku puzzle on the image
-func NewSudoku(image image.Image) (s Sudoku, err error) {
+// Runs pre-processing, image used to find the grid is shrunk if needed
+func prepareSudoku(image image.Image, options Options) *lineSudoku {
 	sudoku := &lineSudoku{
 		BaseImage: image,
+		Size:      options.Size,
+	}
+	if sudoku.Size == (GridSize{}) {
+		sudoku.Size = Grid9x9
 	}
-	width, height := sudoku.BaseImage.Bounds().Max.X, sudoku.BaseImage.Bounds().Max.Y
 
-	t0 := time.Now()
-	sudoku.PreProcessed = preProcess(sudoku.BaseImage)
-	t1 := time.Now()
+	pipeline := options.Pipeline
+	if pipeline == nil {
+		pipeline = DefaultPipeline()
+	}
 
-	nnGrid(sudoku.PreProcessed)
+	maxDimension := options.MaxDimension
+	if maxDimension == 0 {
+		maxDimension = DefaultMaxDimension
+	}
 
-	t2 := time.Now()
-	lines := houghLines(sudoku.PreProcessed, nil, 80, 200)
+	working, scale := downscale(grayImage(sudoku.BaseImage), maxDimension)
+	sudoku.Scale = scale
+	sudoku.PreProcessed, sudoku.Intermediate = pipeline.Run(&working)
+	return sudoku
+}
+
+// Finds grids that could be a sudoku, sorted from the best one.
+// Grids are in coordinates of pre-processed image.
+// Top limits number of line sets taken in each direction for given angle.
+func (l *lineSudoku) candidateGrids(options Options, top uint) []lineGrid {
+	width, height := l.PreProcessed.Bounds().Max.X, l.PreProcessed.Bounds().Max.Y
+	count := l.Size.Lines()
+
+	var lines []polarLine
+	if options.CannyEdges {
+		edges := canny(l.Intermediate[0], 40, 100)
+		lines = orientedHoughLines(edges.Edges, edges.Direction, math.Pi/18, nil, 80, 200)
+	} else {
+		lines = houghLines(l.PreProcessed, nil, 80, 200)
+	}
 	lines = removeDuplicateLines(lines, width, height)
 	bucketSize := 90 / 5
 	buckets := generateAngleBuckets(uint(bucketSize), uint(bucketSize/2.0), true)
@@ -142,25 +361,54 @@ func NewSudoku(image image.Image) (s Sudoku, err error) {
 	grids := make([]lineGrid, 0, 0)
 	for angle, lineClass := range bucketedLines {
 		// don't even bother doing any more work
-		// it's not a 9x9 grid
-		if len(lineClass) < 20 {
+		// there is not enough lines for the grid
+		if len(lineClass) < 2*count {
 			continue
 		}
 
 		vertical, horizontal := linesWithSimilarAngle(lineClass, angle)
 
-		if len(vertical) < 10 || len(horizontal) < 10 {
+		if len(vertical) < count || len(horizontal) < count {
 			continue
 		}
 
-		grids = append(grids, possibleGrids(horizontal, vertical)...)
+		grids = append(grids, possibleGrids(horizontal, vertical, count, top)...)
 	}
 
-	evaluateGrids(sudoku.PreProcessed, grids)
+	if len(grids) == 0 {
+		// Fallback when there is not enough clear lines: use outline of the grid
+		if corners, ok := largestQuadrilateral(l.PreProcessed, 0.05); ok {
+			grid := gridFromCorners(corners, l.Size.Cells)
+			grid.Score = 1
+			grids = append(grids, grid)
+		}
+	}
+
+	grids = evaluateGrids(l.PreProcessed, grids)
+	return verifyBoxBorders(l.PreProcessed, grids, l.Size)
+}
+
+// NewSudoku processes given image in order to find sudoku puzzle on the image
+func NewSudoku(image image.Image) (s Sudoku, err error) {
+	return NewSudokuWithOptions(image, Options{})
+}
+
+// NewSudokuWithOptions works like NewSudoku but allows to customise the process
+func NewSudokuWithOptions(image image.Image, options Options) (s Sudoku, err error) {
+	if options.Size != (GridSize{}) && !options.Size.Valid() {
+		return nil, ErrInvalidSize
+	}
+
+	t0 := time.Now()
+	sudoku := prepareSudoku(image, options)
+	t1 := time.Now()
+
+	nnGrid(sudoku.PreProcessed)
+
+	t2 := time.Now()
+	grids := sudoku.candidateGrids(options, 3)
 	if len(grids) != 0 {
-		sudoku.Grid = grids[0] // Best grid
-		sudoku.Recognised = true
-		extractCells(sudoku.Grid, sudoku.BaseImage)
+		sudoku.setGrid(grids[0], options) // Best grid
 	} else {
 		err = ErrNotRecognised
 	}
@@ -169,3 +417,60 @@ func NewSudoku(image image.Image) (s Sudoku, err error) {
 	fmt.Printf("Time to find Sudoku %v. PreProcessing: %v. NN: %v. Success: %v\n", t3.Sub(t0), t1.Sub(t0), t2.Sub(t1), sudoku.Recognised)
 	return sudoku, err
 }
+
+// FindAll looks for all sudoku puzzles on the image, like a newspaper page.
+// Puzzles are ordered by position on the image: top to bottom, left to right.
+// No puzzles found is not an error.
+func FindAll(image image.Image) ([]Sudoku, error) {
+	return FindAllWithOptions(image, Options{})
+}
+
+// FindAllWithOptions works like FindAll but allows to customise the process
+func FindAllWithOptions(image image.Image, options Options) ([]Sudoku, error) {
+	if options.Size != (GridSize{}) && !options.Size.Valid() {
+		return nil, ErrInvalidSize
+	}
+
+	minScore := options.MinScore
+	if minScore == 0 {
+		minScore = DefaultMinScore
+	}
+
+	prepared := prepareSudoku(image, options)
+	grids := prepared.candidateGrids(options, 10)
+	sort.Stable(lineGridByCoverage(grids))
+
+	var selected []lineGrid
+	for _, grid := range grids {
+		if grid.Score*grid.Coverage < minScore {
+			break // Grids are sorted by score weighted by coverage
+		}
+
+		overlapping := false
+		for _, other := range selected {
+			if gridsOverlap(grid, other) {
+				overlapping = true
+				break
+			}
+		}
+		if !overlapping {
+			selected = append(selected, grid)
+		}
+	}
+
+	sort.Sort(lineGridByPosition(selected))
+
+	sudokus := make([]Sudoku, len(selected), len(selected))
+	for i, grid := range selected {
+		sudoku := &lineSudoku{
+			BaseImage:    prepared.BaseImage,
+			PreProcessed: prepared.PreProcessed,
+			Intermediate: prepared.Intermediate,
+			Scale:        prepared.Scale,
+			Size:         prepared.Size,
+		}
+		sudoku.setGrid(grid, options)
+		sudokus[i] = sudoku
+	}
+	return sudokus, nil
+}
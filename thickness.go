@@ -0,0 +1,157 @@
+package sudoku
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	thicknessSamples = 50  // Max number of places where thickness of a line is measured
+	thicknessSearch  = 3   // How far (px) from expected position line is searched for
+	misalignedRatio  = 1.2 // Inner line this much thicker than box borders means grid is shifted
+	// Grids with scores closer than this are ordered by BoxScore
+	boxScoreTolerance = 0.01
+)
+
+// Measures thickness of set pixels across the line at given point.
+// Line might not be perfectly aligned with pixels, so nearest set pixel
+// within small distance is used as a starting point.
+func strokeThickness(src image.Gray, pt image.Point, normal pointF, maxRun int) int {
+	width, height := src.Bounds().Max.X, src.Bounds().Max.Y
+	isSet := func(offset int) bool {
+		x := pt.X + int(math.Floor(float64(offset)*normal.X+0.5))
+		y := pt.Y + int(math.Floor(float64(offset)*normal.Y+0.5))
+		if x < 0 || x >= width || y < 0 || y >= height {
+			return false
+		}
+		return src.Pix[src.PixOffset(x, y)] != 0
+	}
+
+	start, found := 0, false
+	for d := 0; d <= thicknessSearch && !found; d++ {
+		if isSet(d) {
+			start, found = d, true
+		} else if isSet(-d) {
+			start, found = -d, true
+		}
+	}
+	if !found {
+		return 0
+	}
+
+	thickness := 1
+	for offset := start + 1; offset-start < maxRun && isSet(offset); offset++ {
+		thickness++
+	}
+	for offset := start - 1; start-offset < maxRun && isSet(offset); offset-- {
+		thickness++
+	}
+	return thickness
+}
+
+// Median of stroke thickness measured along line fragment
+func lineThickness(src image.Gray, line polarLine, fragment lineFragment, maxRun int) float64 {
+	points := pointsOnLineFragment(fragment)
+	if len(points) == 0 {
+		return 0
+	}
+
+	normal := pointF{math.Cos(line.Theta), math.Sin(line.Theta)}
+	step := len(points)/thicknessSamples + 1
+
+	var samples []float64
+	for i := 0; i < len(points); i += step {
+		samples = append(samples, float64(strokeThickness(src, points[i], normal, maxRun)))
+	}
+
+	sort.Float64s(samples)
+	return samples[len(samples)/2]
+}
+
+// Compares thickness of box borders (every boxSize line) with other lines.
+// Returns ratio of mean border thickness to mean inner line thickness
+// and whether any inner line is clearly thicker than borders.
+func compareBoxBorders(thickness []float64, boxSize int) (float64, bool) {
+	var border, inner meanAcc
+	maxInner := 0.0
+	for i, t := range thickness {
+		if i%boxSize == 0 {
+			border.Add(t)
+		} else {
+			inner.Add(t)
+			maxInner = math.Max(maxInner, t)
+		}
+	}
+
+	if len(inner.values) == 0 || border.Mean() == 0 {
+		return 1, false
+	}
+
+	misaligned := maxInner > border.Mean()*misalignedRatio
+	if inner.Mean() == 0 {
+		return misalignedRatio, misaligned
+	}
+	return border.Mean() / inner.Mean(), misaligned
+}
+
+// Orders from the best to the worst verified grid.
+// Scores are compared with 0.01 precision, BoxScore breaks ties.
+type lineGridByBoxScore []lineGrid
+
+func (a lineGridByBoxScore) Len() int      { return len(a) }
+func (a lineGridByBoxScore) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a lineGridByBoxScore) Less(i, j int) bool {
+	if math.Abs(a[i].Score-a[j].Score) < boxScoreTolerance {
+		return a[i].BoxScore > a[j].BoxScore
+	}
+	return a[i].Score > a[j].Score // Reversed order most to least
+}
+
+// Checks that box borders are thicker than other lines.
+// Grids with thick line where thin one is expected are removed (misaligned grid),
+// for the rest BoxScore is set to be used as a tie breaker between similar grids.
+// When no grid passes (e.g. all lines have the same width) grids are returned
+// unchanged, so puzzles without thick box borders are still found.
+func verifyBoxBorders(src image.Gray, grids []lineGrid, size GridSize) []lineGrid {
+	verified := make([]lineGrid, 0, len(grids))
+	for _, grid := range grids {
+		hCount, vCount := len(grid.Horizontal), len(grid.Vertical)
+		if hCount != size.Lines() || vCount != size.Lines() {
+			continue
+		}
+
+		corners := grid.Corners()
+		maxRun := int(distanceBetweenPoints(corners[0], corners[2])/float64(2*size.Cells)) + 1
+
+		horizontal := make([]float64, hCount, hCount)
+		for i, h := range grid.Horizontal {
+			_, start := intersection(h, grid.Vertical[0])
+			_, end := intersection(h, grid.Vertical[vCount-1])
+			horizontal[i] = lineThickness(src, h, lineFragment{start, end}, maxRun)
+		}
+
+		vertical := make([]float64, vCount, vCount)
+		for i, v := range grid.Vertical {
+			_, start := intersection(v, grid.Horizontal[0])
+			_, end := intersection(v, grid.Horizontal[hCount-1])
+			vertical[i] = lineThickness(src, v, lineFragment{start, end}, maxRun)
+		}
+
+		// Horizontal lines separate rows, so boxes repeat every BoxHeight of them
+		ratioH, misalignedH := compareBoxBorders(horizontal, size.BoxHeight)
+		ratioV, misalignedV := compareBoxBorders(vertical, size.BoxWidth)
+		if misalignedH || misalignedV {
+			continue
+		}
+
+		grid.BoxScore = ratioH * ratioV
+		verified = append(verified, grid)
+	}
+
+	if len(verified) == 0 {
+		return grids
+	}
+	sort.Sort(lineGridByBoxScore(verified))
+	return verified
+}
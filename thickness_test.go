@@ -0,0 +1,132 @@
+package sudoku
+
+import (
+	"image"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Draws 9x9 sudoku grid with thick box borders, cell size 20px starting at (20, 20)
+func drawSudokuGrid() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 260, 260))
+	for i := 0; i < 10; i++ {
+		pos := 20 + i*20
+		thickness := 1
+		if i%3 == 0 {
+			thickness = 4
+		}
+		for t := 0; t < thickness; t++ {
+			for p := 20; p <= 200; p++ {
+				img.Pix[img.PixOffset(p, pos-thickness/2+t)] = 255
+				img.Pix[img.PixOffset(pos-thickness/2+t, p)] = 255
+			}
+		}
+	}
+	return img
+}
+
+func TestStrokeThickness(t *testing.T) {
+	img := drawSudokuGrid()
+	down := pointF{0, 1}
+
+	assert.Equal(t, 4, strokeThickness(*img, image.Point{30, 20}, down, 10))
+	assert.Equal(t, 4, strokeThickness(*img, image.Point{30, 22}, down, 10)) // Close enough
+	assert.Equal(t, 1, strokeThickness(*img, image.Point{30, 40}, down, 10))
+	assert.Equal(t, 0, strokeThickness(*img, image.Point{30, 30}, down, 10))
+	assert.Equal(t, 3, strokeThickness(*img, image.Point{30, 20}, down, 2)) // Limited in each direction
+}
+
+func TestCompareBoxBorders(t *testing.T) {
+	var examples = []struct {
+		thickness  []float64
+		boxSize    int
+		ratio      float64
+		misaligned bool
+	}{
+		{[]float64{4, 1, 1, 4, 1, 1, 4, 1, 1, 4}, 3, 4, false},
+		{[]float64{2, 2, 2, 2, 2, 2, 2, 2, 2, 2}, 3, 1, false},
+		{[]float64{1, 4, 1, 1, 4, 1, 1, 4, 1, 1}, 3, 0.4, true},
+		{[]float64{4, 1, 4, 1, 4, 1, 4}, 2, 4, false},
+		{[]float64{4, 0, 0, 4}, 3, misalignedRatio, false},
+	}
+
+	for _, tt := range examples {
+		ratio, misaligned := compareBoxBorders(tt.thickness, tt.boxSize)
+		assert.InDelta(t, tt.ratio, ratio, 0.0001, "%v", tt.thickness)
+		assert.Equal(t, tt.misaligned, misaligned, "%v", tt.thickness)
+	}
+}
+
+func TestVerifyBoxBorders(t *testing.T) {
+	img := drawSudokuGrid()
+
+	aligned := squareGrid(20, 20, 20)
+	aligned.Score = 0.9
+	shifted := squareGrid(40, 40, 20)
+	shifted.Score = 0.9
+
+	grids := verifyBoxBorders(*img, []lineGrid{shifted, aligned}, Grid9x9)
+	assert.Len(t, grids, 1)
+	assert.Equal(t, aligned.Horizontal, grids[0].Horizontal)
+	assert.True(t, grids[0].BoxScore > 2)
+
+	// Nothing passes, grids are kept as they were
+	grids = verifyBoxBorders(*img, []lineGrid{aligned}, Grid6x6)
+	assert.Len(t, grids, 1)
+	assert.Equal(t, aligned.Horizontal, grids[0].Horizontal)
+	assert.Equal(t, 0.0, grids[0].BoxScore)
+
+	grids = verifyBoxBorders(*img, []lineGrid{shifted}, Grid9x9)
+	assert.Len(t, grids, 1)
+	assert.Equal(t, shifted.Horizontal, grids[0].Horizontal)
+}
+
+func TestVerifyBoxBordersEvenLines(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 260, 260))
+	for i := 0; i < 10; i++ {
+		pos := 20 + i*20
+		for p := 20; p <= 200; p++ {
+			img.Pix[img.PixOffset(p, pos)] = 255
+			img.Pix[img.PixOffset(pos, p)] = 255
+		}
+	}
+
+	// All lines are thin, e.g. in printed puzzle with no box borders
+	grid := squareGrid(20, 20, 20)
+	grid.Score = 0.9
+	grids := verifyBoxBorders(*img, []lineGrid{grid}, Grid9x9)
+	assert.Len(t, grids, 1)
+}
+
+func TestLineGridByBoxScoreTieBreak(t *testing.T) {
+	grids := []lineGrid{
+		{Score: 0.801, BoxScore: 1},
+		{Score: 0.805, BoxScore: 3},
+		{Score: 0.9, BoxScore: 0},
+	}
+
+	sort.Sort(lineGridByBoxScore(grids))
+	assert.Equal(t, 0.9, grids[0].Score)
+	assert.Equal(t, 0.805, grids[1].Score)
+	assert.Equal(t, 0.801, grids[2].Score)
+
+	// Close scores on both sides of a round number
+	grids = []lineGrid{
+		{Score: 0.801, BoxScore: 1},
+		{Score: 0.799, BoxScore: 3},
+	}
+	sort.Sort(lineGridByBoxScore(grids))
+	assert.Equal(t, 0.799, grids[0].Score)
+
+	// Other callers compare scores only
+	grids = []lineGrid{
+		{Score: 0.9, BoxScore: 0},
+		{Score: 0.801, BoxScore: 3},
+		{Score: 0.805, BoxScore: 1},
+	}
+	sort.Sort(lineGridByScore(grids))
+	assert.Equal(t, 0.805, grids[1].Score)
+	assert.Equal(t, 1.0, grids[1].BoxScore)
+}
@@ -21,8 +21,8 @@ func drawLines(src image.Image, lines []polarLine) image.Image {
 	for _, line := range lines {
 		a := math.Cos(line.Theta)
 		b := math.Sin(line.Theta)
-		x0 := a * float64(line.Distance)
-		y0 := b * float64(line.Distance)
+		x0 := a * line.Distance
+		y0 := b * line.Distance
 		x1 := (x0 + 10000*(-b))
 		y1 := (y0 + 10000*(a))
 		x2 := (x0 - 10000*(-b))
@@ -3,6 +3,24 @@ $(function () {
     var canvas = document.getElementById('canvas');
     var resultSudoku = $("#result");
     var ctx = canvas.getContext('2d');
+    var board = $("#board");
+
+    // Recognised digits with solved ones in empty cells
+    function renderBoard(solved) {
+        $("#solve-error").text(solved.error || "");
+        board.empty();
+        $.each(solved.board, function(row, digits){
+            var tr = $("<tr>").appendTo(board);
+            $.each(digits, function(col, digit){
+                var td = $("<td>").appendTo(tr);
+                if (digit !== 0) {
+                    td.text(digit).addClass("given");
+                } else if (solved.solution) {
+                    td.text(solved.solution[row][col]);
+                }
+            });
+        });
+    }
 
     img.onload = function(){
         var MAX_HEIGHT = 500;
@@ -27,7 +45,35 @@ $(function () {
         img.src = window.URL.createObjectURL(files[0]);
     });
 
+    if (board.length === 1) {
+        renderBoard(board.data('solved'));
+    }
+
     if (resultSudoku.length === 1) {
         img.src = resultSudoku.attr('src');
     }
+
+    // Puzzle is sent with every correction, server does not keep it
+    var puzzle = resultSudoku.data('puzzle');
+    if (puzzle) {
+        // Tap on a cell to fix misread digit
+        $(canvas).on("click", function(event){
+            var digit = window.prompt("Digit (0 clears the cell)");
+            if (digit === null) { return; }
+
+            var rect = canvas.getBoundingClientRect();
+            var scale = img.width / canvas.width;
+            $.post("/correct", {
+                puzzle: JSON.stringify(puzzle),
+                x: (event.clientX - rect.left) * scale,
+                y: (event.clientY - rect.top) * scale,
+                digit: digit
+            }).done(function(solved){
+                puzzle.Board = solved.board;
+                renderBoard(solved);
+            }).fail(function(xhr){
+                window.alert(xhr.responseText);
+            });
+        });
+    }
 });
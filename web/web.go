@@ -3,20 +3,117 @@ package web
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"html/template"
 	"image"
 	_ "image/jpeg" // Enable processing JPEG files
 	"image/png"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/mrfuxi/sudoku"
 )
 
 var templates = template.Must(template.ParseGlob("templates/*.html"))
 
+// Size of extracted puzzle, unless given in the form
+const (
+	defaultExtractedSize = 450
+	maxExtractedSize     = 2000
+)
+
+var errInvalidSize = errors.New("Invalid size of extracted image")
+
+// Reads optional size of extracted image from the form
+func extractedSize(req *http.Request, name string) (int, error) {
+	value := req.FormValue(name)
+	if value == "" {
+		return defaultExtractedSize, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 || size > maxExtractedSize {
+		return 0, errInvalidSize
+	}
+	return size, nil
+}
+
+// Recognised puzzle with digits corrected by the user. The page keeps it and
+// sends it back with every correction, so any instance of the app can handle it.
+type puzzle struct {
+	Geometry *sudoku.Geometry
+	Board    [][]int // 0 for empty cell
+}
+
+// Limits body of correction, puzzle of 16x16 cells takes about 30kB
+const maxCorrectionSize = 1 << 17
+
 func init() {
 	http.HandleFunc("/", upload)
+	http.HandleFunc("/correct", correct)
+}
+
+// Board of recognised digits, empty when digits could not be recognised
+func recognisedBoard(s sudoku.Sudoku, cells int) [][]int {
+	board := make([][]int, cells, cells)
+	for row := range board {
+		board[row] = make([]int, cells, cells)
+	}
+
+	recognised, err := s.Digits()
+	if err != nil {
+		log.Println("Could not recognise digits.", err.Error())
+		return board
+	}
+	for row := range recognised {
+		for col, cell := range recognised[row] {
+			if cell.Kind != sudoku.CellEmpty && row < cells && col < cells {
+				board[row][col] = cell.Digit
+			}
+		}
+	}
+	return board
+}
+
+// Tells whether board has given number of cells in each row and column
+// and only digits allowed in them
+func validBoard(board [][]int, cells int) bool {
+	if len(board) != cells {
+		return false
+	}
+	for _, row := range board {
+		if len(row) != cells {
+			return false
+		}
+		for _, digit := range row {
+			if digit < 0 || digit > cells {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Board as shown on the page, with solution when there is one
+func solvedBoard(board [][]int, size sudoku.GridSize) map[string]interface{} {
+	solved := map[string]interface{}{"board": board}
+	solution, err := sudoku.Solve(board, size)
+	if err != nil {
+		solved["error"] = err.Error()
+	} else {
+		solved["solution"] = solution
+	}
+	return solved
+}
+
+func toJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Could not encode JSON.", err.Error())
+		return ""
+	}
+	return string(data)
 }
 
 func imageToBase64(img image.Image) string {
@@ -25,37 +122,100 @@ func imageToBase64(img image.Image) string {
 	return base64.StdEncoding.EncodeToString(buf.Bytes())
 }
 
-func processForm(req *http.Request, context map[string]string) {
+// Processes uploaded image, returns HTTP status of the response
+func processForm(req *http.Request, context map[string]string) int {
+	width, errWidth := extractedSize(req, "width")
+	height, errHeight := extractedSize(req, "height")
+	if errWidth != nil || errHeight != nil {
+		context["Error"] = errInvalidSize.Error()
+		return http.StatusBadRequest
+	}
+
 	file, handler, err := req.FormFile("uploadfile")
 	if err != nil {
 		context["Error"] = "Sudoku file missing"
 		log.Println("Could not open sudoku file.", err.Error())
-		return
+		return http.StatusOK
 	}
 
 	if len(handler.Header["Content-Type"]) > 0 {
 		context["ContentType"] = handler.Header["Content-Type"][0]
 	}
 
-	img, _, err := image.Decode(file)
+	img, _, err := sudoku.DecodeImage(file)
 	if err != nil {
 		context["Error"] = "Could not read the file"
 		log.Println("Could not read the file.", err.Error())
-		return
+		return http.StatusOK
 	}
 	s, err := sudoku.NewSudoku(img)
 	if err != nil {
 		context["Error"] = err.Error()
 		log.Println(err.Error())
-		return
+		return http.StatusOK
 	}
 	context["Image"] = imageToBase64(s.Overlay())
+	context["Extracted"] = imageToBase64(s.ExtractedWithOptions(sudoku.ExtractOptions{
+		Width:  width,
+		Height: height,
+		Color:  true,
+	}))
+
+	geometry := s.Geometry()
+	board := recognisedBoard(s, geometry.Size.Cells)
+	context["Puzzle"] = toJSON(puzzle{Geometry: geometry, Board: board})
+	context["Solved"] = toJSON(solvedBoard(board, geometry.Size))
+	return http.StatusOK
+}
+
+// Sets digit in the cell tapped at x, y (original image coordinates)
+// of the puzzle sent with it and solves corrected board
+func correct(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(rw, "Only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req.Body = http.MaxBytesReader(rw, req.Body, maxCorrectionSize)
+
+	x, errX := strconv.ParseFloat(req.FormValue("x"), 64)
+	y, errY := strconv.ParseFloat(req.FormValue("y"), 64)
+	digit, errDigit := strconv.Atoi(req.FormValue("digit"))
+	if errX != nil || errY != nil || errDigit != nil {
+		http.Error(rw, "Invalid correction", http.StatusBadRequest)
+		return
+	}
+
+	var p puzzle
+	err := json.Unmarshal([]byte(req.FormValue("puzzle")), &p)
+	if err != nil || p.Geometry == nil || !validBoard(p.Board, p.Geometry.Size.Cells) {
+		http.Error(rw, "Invalid puzzle", http.StatusBadRequest)
+		return
+	}
+
+	row, col, ok := p.Geometry.CellAt(x, y)
+	if !ok {
+		http.Error(rw, "No cell at given point", http.StatusBadRequest)
+		return
+	}
+	if digit < 0 || digit > p.Geometry.Size.Cells {
+		http.Error(rw, "Invalid digit", http.StatusBadRequest)
+		return
+	}
+	p.Board[row][col] = digit
+
+	solved := solvedBoard(p.Board, p.Geometry.Size)
+	solved["row"] = row
+	solved["col"] = col
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(solved)
 }
 
 func upload(rw http.ResponseWriter, req *http.Request) {
 	context := map[string]string{}
 	if req.Method == "POST" {
-		processForm(req, context)
+		if status := processForm(req, context); status != http.StatusOK {
+			rw.WriteHeader(status)
+		}
 	}
 
 	if err := templates.ExecuteTemplate(rw, "sudoku.html", context); err != nil {